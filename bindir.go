@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// linkFileName is the name of the ddn link on this platform
+func linkFileName() string {
+	if runtime.GOOS == "windows" {
+		return binName + ".exe"
+	}
+	return binName
+}
+
+// resolveBinDir picks the directory for the ddn link: --bin-dir or the
+// bin_dir setting, then the recorded location, then a guess from PATH. The
+// second return value describes where the directory came from.
+func resolveBinDir() (string, string, error) {
+	if configuredBinDir != "" {
+		dir, err := filepath.Abs(configuredBinDir)
+		if err != nil {
+			return "", "", err
+		}
+		return dir, "bin_dir setting", nil
+	}
+
+	dir, err := readRecordedBinDir()
+	if err != nil {
+		return "", "", err
+	}
+	if dir != "" {
+		return dir, "recorded in the store", nil
+	}
+
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir, err = guessBinDir(homeDir)
+	if err != nil {
+		return "", "", err
+	}
+	return dir, "guessed from PATH", nil
+}
+
+// readRecordedBinDir returns the directory of the recorded link, or an empty string
+func readRecordedBinDir() (string, error) {
+	if _, err := getInstallDir(); err != nil {
+		return "", err
+	}
+	state := readState()
+	if state.LinkPath == "" {
+		return "", nil
+	}
+	return filepath.Dir(state.LinkPath), nil
+}
+
+// recordLinkPath remembers symlinkPath as the location of the ddn link
+func recordLinkPath(symlinkPath string) error {
+	if readState().LinkPath == symlinkPath {
+		return nil
+	}
+	debugLog("Recording link location %s", symlinkPath)
+	return updateState(func(state *State) {
+		state.LinkPath = symlinkPath
+	})
+}
+
+// sameDir reports whether two paths name the same directory, following symlinks
+func sameDir(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	resolvedA, err1 := filepath.EvalSymlinks(a)
+	resolvedB, err2 := filepath.EvalSymlinks(b)
+	return err1 == nil && err2 == nil && resolvedA == resolvedB
+}
+
+// isExecutableFile reports whether path is a file a shell would run
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// shadowingBinaries returns the ddn binaries found on PATH before binDir. The
+// second return value is false when binDir is not on PATH at all.
+func shadowingBinaries(binDir string) ([]string, bool) {
+	var shadows []string
+	for _, pathDir := range filepath.SplitList(os.Getenv("PATH")) {
+		if pathDir == "" {
+			continue
+		}
+		if sameDir(pathDir, binDir) {
+			return shadows, true
+		}
+		if candidate := filepath.Join(pathDir, linkFileName()); isExecutableFile(candidate) {
+			shadows = append(shadows, candidate)
+		}
+	}
+	return shadows, false
+}
+
+// warnIfShadowed tells the user when the ddn link at symlinkPath is not the
+// ddn their shell will run
+func warnIfShadowed(symlinkPath string) {
+	binDir := filepath.Dir(symlinkPath)
+	shadows, onPath := shadowingBinaries(binDir)
+	if len(shadows) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s is shadowed by %s earlier in PATH\n", symlinkPath, strings.Join(shadows, ", "))
+		fmt.Fprintf(os.Stderr, "Remove it, move %s before it in PATH, or pick another directory with --bin-dir\n", binDir)
+		return
+	}
+	if !onPath {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not in PATH; add it to use the linked ddn\n", binDir)
+	}
+}
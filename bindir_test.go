@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveBinDirPrecedence(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("PATH", strings.Join([]string{filepath.Join(home, "tools"), filepath.Join(home, ".local", "bin")}, string(os.PathListSeparator)))
+
+	originalGetInstallDir := getInstallDir
+	originalBinDir := configuredBinDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		configuredBinDir = originalBinDir
+	}()
+	installDir := filepath.Join(home, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	configuredBinDir = ""
+
+	// Without anything configured or recorded, a well-known directory on PATH is guessed
+	dir, source, err := resolveBinDir()
+	if err != nil || dir != filepath.Join(home, ".local", "bin") {
+		t.Fatalf("Expected ~/.local/bin to be guessed, got %s (%s, %v)", dir, source, err)
+	}
+
+	// Guessing never writes probe files into PATH directories
+	if entries, _ := os.ReadDir(filepath.Join(home, "tools")); len(entries) > 0 {
+		t.Fatalf("Expected no files to be created while guessing, found %v", entries)
+	}
+
+	// The recorded location beats the guess
+	recorded := filepath.Join(home, "tools")
+	if err := recordLinkPath(filepath.Join(recorded, linkFileName())); err != nil {
+		t.Fatalf("Failed to record link location: %v", err)
+	}
+	if dir, _, _ := resolveBinDir(); dir != recorded {
+		t.Fatalf("Expected the recorded directory %s, got %s", recorded, dir)
+	}
+
+	// --bin-dir and the bin_dir setting beat both
+	configuredBinDir = filepath.Join(home, "explicit")
+	if dir, _, _ := resolveBinDir(); dir != configuredBinDir {
+		t.Fatalf("Expected the configured directory %s, got %s", configuredBinDir, dir)
+	}
+}
+
+func TestCreateSymlinkRecordsBinDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalBinDir := configuredBinDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		configuredBinDir = originalBinDir
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	installMockVersions(t, installDir, "v3.0.1")
+
+	// A switch with --bin-dir is remembered once the flag is gone
+	configuredBinDir = filepath.Join(tempDir, "bin")
+	binPath, _ := versionBinPath("v3.0.1")
+	if err := createSymlink(binPath); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	configuredBinDir = ""
+
+	symlinkPath, err := getSymlinkPath()
+	if err != nil {
+		t.Fatalf("Failed to get symlink path: %v", err)
+	}
+	if symlinkPath != filepath.Join(tempDir, "bin", binName) {
+		t.Fatalf("Expected the recorded link location, got %s", symlinkPath)
+	}
+	if target, err := os.Readlink(symlinkPath); err != nil || target != binPath {
+		t.Fatalf("Expected %s to point to %s, got %s (%v)", symlinkPath, binPath, target, err)
+	}
+}
+
+func TestShadowingBinaries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	earlier := filepath.Join(tempDir, "earlier")
+	binDir := filepath.Join(tempDir, "bin")
+	later := filepath.Join(tempDir, "later")
+	for _, dir := range []string{earlier, binDir, later} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, binName), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create ddn in %s: %v", dir, err)
+		}
+	}
+	// A ddn that isn't executable doesn't shadow anything
+	notExecutable := filepath.Join(tempDir, "docs")
+	if err := os.MkdirAll(notExecutable, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", notExecutable, err)
+	}
+	if err := os.WriteFile(filepath.Join(notExecutable, binName), []byte("docs"), 0644); err != nil {
+		t.Fatalf("Failed to create ddn docs: %v", err)
+	}
+
+	t.Setenv("PATH", strings.Join([]string{notExecutable, earlier, binDir, later}, string(os.PathListSeparator)))
+
+	shadows, onPath := shadowingBinaries(binDir)
+	if !onPath {
+		t.Fatal("Expected the bin directory to be found on PATH")
+	}
+	if len(shadows) != 1 || shadows[0] != filepath.Join(earlier, binName) {
+		t.Fatalf("Expected only %s to shadow the link, got %v", filepath.Join(earlier, binName), shadows)
+	}
+
+	if _, onPath := shadowingBinaries(filepath.Join(tempDir, "elsewhere")); onPath {
+		t.Fatal("Expected a directory missing from PATH to be reported")
+	}
+}
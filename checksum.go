@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// skipVerify disables checksum verification of downloaded binaries
+var skipVerify bool
+
+// assetName returns the release asset name of the DDN CLI binary for a platform
+func assetName(osName, archName string) string {
+	name := fmt.Sprintf("cli-ddn-%s-%s", osName, archName)
+	if osName == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// parseSHA256 extracts a hex SHA-256 from "sha256:<hex>", "<hex>" or the
+// "<hex>  <filename>" format written by sha256sum
+func parseSHA256(s string) (string, error) {
+	fields := strings.Fields(strings.TrimSpace(s))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum")
+	}
+
+	sum := strings.ToLower(strings.TrimPrefix(fields[0], "sha256:"))
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q", fields[0])
+	}
+	return sum, nil
+}
+
+// lookupChecksum finds the published SHA-256 of a platform's binary at
+// downloadURL, first in the release index and then in a sibling .sha256 file.
+// It returns an empty string when no checksum is published.
+var lookupChecksum = func(version, downloadURL, osName, archName string) (string, error) {
+	return lookupChecksumImpl(version, downloadURL, osName, archName)
+}
+
+func lookupChecksumImpl(version, downloadURL, osName, archName string) (string, error) {
+	if sum := indexChecksum(version, osName, archName); sum != "" {
+		debugLog("Using checksum %s from the release index", sum)
+		return sum, nil
+	}
+
+	sum, err := fetchChecksumFile(downloadURL + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	if sum != "" {
+		debugLog("Using checksum %s from %s.sha256", sum, downloadURL)
+	}
+	return sum, nil
+}
+
+// indexChecksum returns the digest recorded in the release index for a
+// platform's asset of version, if any
+func indexChecksum(version, osName, archName string) string {
+	asset := indexAsset(version, osName, archName)
+	if asset == nil || asset.Digest == "" {
+		return ""
+	}
+	sum, err := parseSHA256(asset.Digest)
+	if err != nil {
+		debugLog("Ignoring digest of %s: %v", asset.Name, err)
+		return ""
+	}
+	return sum
+}
+
+// fetchChecksumFile downloads a .sha256 file, returning an empty string if it doesn't exist
+func fetchChecksumFile(url string) (string, error) {
+	if strings.HasPrefix(url, "file://") {
+		body, _, err := openDownload(url)
+		if os.IsNotExist(err) {
+			debugLog("No checksum file at %s", url)
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read checksum: %w", err)
+		}
+		defer body.Close()
+		data, err := io.ReadAll(io.LimitReader(body, 4096))
+		if err != nil {
+			return "", fmt.Errorf("failed to read checksum: %w", err)
+		}
+		return parseSHA256(string(data))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		debugLog("No checksum file at %s (HTTP %d)", url, resp.StatusCode)
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch checksum: HTTP status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum: %w", err)
+	}
+	return parseSHA256(string(data))
+}
+
+// expectedChecksum decides which SHA-256 a download must match. A lock file
+// wins over published checksums. With --skip-verify it returns an empty string
+// after printing a warning.
+func expectedChecksum(version, downloadURL string, locked *LockedBinary) (string, error) {
+	if locked != nil {
+		return locked.SHA256, nil
+	}
+
+	if skipVerify {
+		fmt.Fprintf(os.Stderr, "WARNING: --skip-verify is set, DDN CLI %s will be installed WITHOUT checksum verification\n", version)
+		return "", nil
+	}
+
+	sum, err := lookupChecksum(version, downloadURL, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up checksum: %w", err)
+	}
+	if sum == "" {
+		return "", fmt.Errorf("no checksum published for DDN CLI %s on %s; use --skip-verify to install it unverified", version, currentPlatform())
+	}
+	return sum, nil
+}
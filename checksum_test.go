@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSHA256(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	for _, input := range []string{sum, "sha256:" + sum, sum + "  cli-ddn-linux-amd64\n", strings.ToUpper(sum)} {
+		parsed, err := parseSHA256(input)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", input, err)
+		}
+		if parsed != sum {
+			t.Fatalf("Expected %s, got %s", sum, parsed)
+		}
+	}
+
+	for _, input := range []string{"", "sha256:xyz", "abcd"} {
+		if _, err := parseSHA256(input); err == nil {
+			t.Fatalf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestDownloadBinaryChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered binary"))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "ddn")
+	err := downloadBinary(server.URL, destPath, strings.Repeat("0", 64))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch error, got %v", err)
+	}
+
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Fatal("Mismatching download was not deleted")
+	}
+}
+
+func TestLookupChecksumFallsBackToSiblingFile(t *testing.T) {
+	sum := strings.Repeat("cd", 32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3.0.1/cli-ddn.sha256" {
+			w.Write([]byte(sum + "  cli-ddn\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	// The index knows the release but publishes no digest for it
+	primeVersionCache(t, "v3.0.1")
+
+	found, err := lookupChecksum("v3.0.1", server.URL+"/v3.0.1/cli-ddn", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("Failed to look up checksum: %v", err)
+	}
+	if found != sum {
+		t.Fatalf("Expected %s, got %s", sum, found)
+	}
+
+	found, err = lookupChecksum("v3.0.2", server.URL+"/v3.0.2/cli-ddn", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("Failed to look up checksum: %v", err)
+	}
+	if found != "" {
+		t.Fatalf("Expected no checksum, got %s", found)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileName        = "config.yaml"
+	projectConfigFileName = ".ddnswitch.yaml"
+	configEnvPrefix       = "DDNSWITCH_"
+)
+
+// Where a setting's effective value came from, lowest precedence first
+const (
+	sourceDefault = "default"
+	sourceUser    = "user"
+	sourceProject = "project"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+var (
+	// configuredInstallDir overrides the install directory when set
+	configuredInstallDir string
+	// configuredBinDir is where the ddn link goes when set
+	configuredBinDir string
+)
+
+// setting is a configuration key that can be set by flag, DDNSWITCH_* env
+// var, project .ddnswitch.yaml or user config.yaml
+type setting struct {
+	key   string
+	flag  string // persistent flag bound to the same value, if any
+	usage string
+	// resolve makes a relative value from a config file relative to its directory
+	resolve func(value, baseDir string) string
+	// userOnly settings are ignored in project files, which anyone can
+	// commit: everything that decides which binaries are downloaded, where
+	// they live or what ends up on PATH
+	userOnly bool
+	// list settings are YAML sequences and comma separated in env vars
+	list bool
+	get  func() string
+	set  func(value string) error
+}
+
+// envVar returns the environment variable of the setting
+func (s *setting) envVar() string {
+	return configEnvPrefix + strings.ToUpper(s.key)
+}
+
+var settings = []*setting{
+	{
+		key: "install_dir", resolve: resolveConfigPath, userOnly: true,
+		usage: "Directory holding the installed DDN CLI versions",
+		get:   func() string { return configuredInstallDir },
+		set:   func(v string) error { configuredInstallDir = v; return nil },
+	},
+	{
+		key: "bin_dir", flag: "bin-dir", resolve: resolveConfigPath, userOnly: true,
+		usage: "Directory on PATH where the ddn link is created",
+		get:   func() string { return configuredBinDir },
+		set:   func(v string) error { configuredBinDir = v; return nil },
+	},
+	{
+		key: "source", flag: "source", resolve: resolveSourcePath, userOnly: true,
+		usage: "Release index: github[:owner/repo], an http(s) URL, or a file:// URL or local path",
+		get:   func() string { return releaseSourceSpec },
+		set:   func(v string) error { releaseSourceSpec = v; return nil },
+	},
+	{
+		key: "download_url", flag: "download-url", userOnly: true,
+		usage: "Download URL template with {version}, {os}, {arch} and {ext} placeholders",
+		get:   func() string { return downloadURLTemplate },
+		set:   func(v string) error { downloadURLTemplate = v; return nil },
+	},
+	{
+		key: "mirrors", flag: "mirror", list: true, userOnly: true,
+		usage: "Download URL templates tried in order when a download fails",
+		get:   func() string { return strings.Join(downloadMirrors, ",") },
+		set:   func(v string) error { downloadMirrors = splitList(v); return nil },
+	},
+	{
+		key: "cache_ttl", flag: "cache-ttl",
+		usage: "How long the cached release index is used before it is revalidated",
+		get:   func() string { return cacheTTL.String() },
+		set:   durationSetter(&cacheTTL),
+	},
+	{
+		key: "lock_timeout", flag: "lock-timeout",
+		usage: "How long to wait for another ddnswitch process to release the install directory",
+		get:   func() string { return lockTimeout.String() },
+		set:   durationSetter(&lockTimeout),
+	},
+	{
+		key: "prerelease", flag: "pre",
+		usage: "Include pre-release versions",
+		get:   func() string { return strconv.FormatBool(includePrerelease) },
+		set:   boolSetter(&includePrerelease),
+	},
+	{
+		key: "offline", flag: "offline",
+		usage: "Never use the network; work from installed versions and the cached release index",
+		get:   func() string { return strconv.FormatBool(offlineMode) },
+		set:   boolSetter(&offlineMode),
+	},
+	{
+		key: "allow_unsigned_index", flag: "allow-unsigned-index", userOnly: true,
+		usage: "Use a release index that can't be signature-verified",
+		get:   func() string { return strconv.FormatBool(allowUnsignedIndex) },
+		set:   boolSetter(&allowUnsignedIndex),
+	},
+	{
+		key: "index_pubkey", userOnly: true,
+		usage: "Trusted key for the release index signature",
+		get:   func() string { return indexPublicKey },
+		set:   func(v string) error { indexPublicKey = v; return nil },
+	},
+}
+
+func durationSetter(target *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*target = d
+		return nil
+	}
+}
+
+func boolSetter(target *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*target = b
+		return nil
+	}
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func lookupSetting(key string) (*setting, error) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown setting %q; run `ddnswitch config list` to see all settings", key)
+}
+
+// getConfigDir returns the directory of the user config file
+var getConfigDir = func() (string, error) {
+	return defaultConfigDir()
+}
+
+func userConfigPath() (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, configFileName), nil
+}
+
+// projectConfigPath returns the nearest .ddnswitch.yaml at or above the
+// current directory, or an empty string
+func projectConfigPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return findUpwards(cwd, projectConfigFileName)
+}
+
+// readConfigFile returns the settings in a config file as strings. A missing
+// file has no settings.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// configValue is the effective value of a setting and where it came from
+type configValue struct {
+	value  string
+	source string
+	origin string // file or env var the value came from
+}
+
+// resolvedConfig holds the value each setting ended up with
+var resolvedConfig = map[string]configValue{}
+
+// configDefaults are the values settings have before any config is applied
+var configDefaults = map[string]string{}
+
+func init() {
+	for _, s := range settings {
+		configDefaults[s.key] = s.get()
+	}
+}
+
+// applyConfig sets every setting from, in increasing precedence, the user
+// config, the project config and the environment. Settings whose flag was
+// given on the command line are left alone. flags may be nil.
+func applyConfig(flags *pflag.FlagSet) error {
+	type layer struct {
+		source string
+		path   string
+		values map[string]string
+	}
+	var layers []layer
+
+	userPath, err := userConfigPath()
+	if err != nil {
+		return err
+	}
+	userValues, err := readConfigFile(userPath)
+	if err != nil {
+		return err
+	}
+	layers = append(layers, layer{sourceUser, userPath, userValues})
+
+	projectPath, err := projectConfigPath()
+	if err != nil {
+		return err
+	}
+	if projectPath != "" {
+		debugLog("Using project config %s", projectPath)
+		projectValues, err := readConfigFile(projectPath)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer{sourceProject, projectPath, projectValues})
+	}
+
+	for _, l := range layers {
+		for key := range l.values {
+			if _, err := lookupSetting(key); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring unknown setting %q in %s\n", key, l.path)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if s.flag != "" && flags != nil {
+			if f := flags.Lookup(s.flag); f != nil && f.Changed {
+				resolvedConfig[s.key] = configValue{value: s.get(), source: sourceFlag, origin: "--" + s.flag}
+				continue
+			}
+		}
+
+		resolved := configValue{value: configDefaults[s.key], source: sourceDefault}
+		for _, l := range layers {
+			value, ok := l.values[s.key]
+			if !ok {
+				continue
+			}
+			if s.userOnly && l.source == sourceProject {
+				fmt.Fprintf(os.Stderr, "Warning: %s can only be set in the user config, ignoring it in %s\n", s.key, l.path)
+				continue
+			}
+			if s.resolve != nil {
+				value = s.resolve(value, filepath.Dir(l.path))
+			}
+			resolved = configValue{value: value, source: l.source, origin: l.path}
+		}
+		if value, ok := os.LookupEnv(s.envVar()); ok {
+			resolved = configValue{value: value, source: sourceEnv, origin: s.envVar()}
+			if s.resolve != nil {
+				resolved.value = expandHome(value)
+			}
+		}
+
+		if err := s.set(resolved.value); err != nil {
+			if resolved.origin == "" {
+				return fmt.Errorf("%s: %w", s.key, err)
+			}
+			return fmt.Errorf("%s in %s: %w", s.key, resolved.origin, err)
+		}
+		resolvedConfig[s.key] = resolved
+	}
+	return nil
+}
+
+// expandHome expands a leading ~ to the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := getHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// resolveConfigPath makes a path from a config file absolute, relative to the file
+func resolveConfigPath(path, baseDir string) string {
+	if path == "" {
+		return path
+	}
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	return path
+}
+
+// resolveSourcePath resolves a local release source like a path, leaving
+// GitHub and URL sources alone
+func resolveSourcePath(spec, baseDir string) string {
+	if spec == "" || spec == githubSourcePrefix || strings.HasPrefix(spec, githubSourcePrefix+":") || strings.Contains(spec, "://") {
+		return spec
+	}
+	return resolveConfigPath(spec, baseDir)
+}
+
+// setConfigValue writes key to the config file at path, keeping the rest of
+// the file (including comments) as it is
+func setConfigValue(path, key, value string) error {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return err
+	}
+
+	// Validate the value with the same parser used when loading it
+	previous := s.get()
+	err = s.set(value)
+	s.set(previous)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping of settings", path)
+	}
+
+	valueNode := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if s.list {
+		valueNode = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range splitList(value) {
+			valueNode.Content = append(valueNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+		}
+	}
+
+	replaced := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			valueNode.HeadComment = mapping.Content[i+1].HeadComment
+			valueNode.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = valueNode
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// configFileForWrite picks the file `config set` writes: the user config, or
+// with project the nearest .ddnswitch.yaml (created in the current directory
+// if there is none)
+func configFileForWrite(key string, project bool) (string, error) {
+	if !project {
+		return userConfigPath()
+	}
+
+	s, err := lookupSetting(key)
+	if err != nil {
+		return "", err
+	}
+	if s.userOnly {
+		return "", fmt.Errorf("%s can only be set in the user config", key)
+	}
+
+	path, err := projectConfigPath()
+	if err != nil || path != "" {
+		return path, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cwd, projectConfigFileName), nil
+}
+
+// printConfigValue prints the effective value of a setting
+func printConfigValue(key string) error {
+	if _, err := lookupSetting(key); err != nil {
+		return err
+	}
+	fmt.Println(resolvedConfig[key].value)
+	return nil
+}
+
+// printConfig lists every setting with its effective value and where it
+// came from, each line starting with indent
+func printConfig(indent string) {
+	keys := make([]string, 0, len(settings))
+	for _, s := range settings {
+		keys = append(keys, s.key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		resolved := resolvedConfig[key]
+		origin := resolved.source
+		if resolved.origin != "" {
+			origin += " " + resolved.origin
+		}
+		fmt.Printf("%s%-13s = %-40s (%s)\n", indent, key, resolved.value, origin)
+	}
+}
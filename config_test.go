@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// isolateConfig points the user config at a temp directory and restores every
+// setting after the test
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+	configDir := t.TempDir()
+
+	originalGetConfigDir := getConfigDir
+	getConfigDir = func() (string, error) {
+		return configDir, nil
+	}
+
+	saved := map[string]string{}
+	for _, s := range settings {
+		saved[s.key] = s.get()
+		t.Setenv(s.envVar(), "")
+		os.Unsetenv(s.envVar())
+	}
+
+	t.Cleanup(func() {
+		getConfigDir = originalGetConfigDir
+		for _, s := range settings {
+			s.set(saved[s.key])
+		}
+	})
+	return configDir
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	configDir := isolateConfig(t)
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	userConfig := "cache_ttl: 10m\nlock_timeout: 1m\nprerelease: true\ninstall_dir: ~/ddn-versions\nsource: ./index\nmirrors:\n  - https://a.example.com/{version}\n  - https://b.example.com/{version}\n"
+	if err := os.WriteFile(filepath.Join(configDir, configFileName), []byte(userConfig), 0644); err != nil {
+		t.Fatalf("Failed to write user config: %v", err)
+	}
+	projectConfig := "cache_ttl: 20m\nlock_timeout: 2m\n"
+	if err := os.WriteFile(filepath.Join(projectDir, projectConfigFileName), []byte(projectConfig), 0644); err != nil {
+		t.Fatalf("Failed to write project config: %v", err)
+	}
+	t.Setenv("DDNSWITCH_LOCK_TIMEOUT", "3m")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "")
+	if err := flags.Parse([]string{"--lock-timeout=4m"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if err := applyConfig(flags); err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+
+	// flag > env > project > user
+	if lockTimeout != 4*time.Minute || resolvedConfig["lock_timeout"].source != sourceFlag {
+		t.Fatalf("Expected the flag to win, got %v from %s", lockTimeout, resolvedConfig["lock_timeout"].source)
+	}
+	if cacheTTL != 20*time.Minute || resolvedConfig["cache_ttl"].source != sourceProject {
+		t.Fatalf("Expected the project config to win, got %v", cacheTTL)
+	}
+	if !includePrerelease || resolvedConfig["prerelease"].source != sourceUser {
+		t.Fatal("Expected prerelease from the user config")
+	}
+
+	// Lists and paths relative to the file that sets them
+	if len(downloadMirrors) != 2 || downloadMirrors[1] != "https://b.example.com/{version}" {
+		t.Fatalf("Unexpected mirrors: %v", downloadMirrors)
+	}
+	if releaseSourceSpec != filepath.Join(configDir, "index") {
+		t.Fatalf("Expected the source relative to the user config, got %s", releaseSourceSpec)
+	}
+	home, _ := getHomeDir()
+	if configuredInstallDir != filepath.Join(home, "ddn-versions") {
+		t.Fatalf("Expected ~ to be expanded, got %s", configuredInstallDir)
+	}
+
+	// Without the flag, the env var is next in line
+	if err := applyConfig(nil); err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+	if lockTimeout != 3*time.Minute || resolvedConfig["lock_timeout"].source != sourceEnv {
+		t.Fatalf("Expected the env var to win, got %v", lockTimeout)
+	}
+}
+
+func TestApplyConfigRejectsInvalidValues(t *testing.T) {
+	isolateConfig(t)
+	chdirForTest(t, t.TempDir())
+
+	t.Setenv("DDNSWITCH_CACHE_TTL", "soon")
+	err := applyConfig(nil)
+	if err == nil || !strings.Contains(err.Error(), "DDNSWITCH_CACHE_TTL") {
+		t.Fatalf("Expected an error naming the env var, got %v", err)
+	}
+}
+
+func TestProjectConfigCannotSetTrustedSettings(t *testing.T) {
+	isolateConfig(t)
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	// A cloned repository must not pick what gets downloaded, run or put on PATH
+	projectConfig := "index_pubkey: RWQattacker\nallow_unsigned_index: true\ninstall_dir: .tools\nbin_dir: .bin\n" +
+		"source: ./index\ndownload_url: https://evil.example.com/{version}\nmirrors:\n  - https://evil.example.com/{version}\n"
+	if err := os.WriteFile(filepath.Join(projectDir, projectConfigFileName), []byte(projectConfig), 0644); err != nil {
+		t.Fatalf("Failed to write project config: %v", err)
+	}
+	if err := applyConfig(nil); err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+
+	for _, key := range []string{"index_pubkey", "allow_unsigned_index", "install_dir", "bin_dir", "source", "download_url", "mirrors"} {
+		if resolvedConfig[key].source != sourceDefault {
+			t.Errorf("A project config must not set %s, got it from %s", key, resolvedConfig[key].source)
+		}
+		if _, err := configFileForWrite(key, true); err == nil {
+			t.Errorf("Expected %s to be refused for the project config", key)
+		}
+	}
+}
+
+func TestSetConfigValueKeepsComments(t *testing.T) {
+	isolateConfig(t)
+	path := filepath.Join(t.TempDir(), configFileName)
+	if err := os.WriteFile(path, []byte("# shared team settings\ncache_ttl: 1h # refresh hourly\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := setConfigValue(path, "cache_ttl", "30m"); err != nil {
+		t.Fatalf("Failed to set cache_ttl: %v", err)
+	}
+	if err := setConfigValue(path, "mirrors", "https://a.example.com/{version},https://b.example.com/{version}"); err != nil {
+		t.Fatalf("Failed to set mirrors: %v", err)
+	}
+	if err := setConfigValue(path, "cache_ttl", "later"); err == nil {
+		t.Fatal("Expected an invalid duration to be rejected")
+	}
+	if err := setConfigValue(path, "no_such_setting", "x"); err == nil {
+		t.Fatal("Expected an unknown setting to be rejected")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	content := string(data)
+	for _, expected := range []string{"# shared team settings", "cache_ttl: 30m # refresh hourly", "- https://b.example.com/{version}"} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("Expected %q in config, got:\n%s", expected, content)
+		}
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config back: %v", err)
+	}
+	if values["mirrors"] != "https://a.example.com/{version},https://b.example.com/{version}" {
+		t.Fatalf("Unexpected mirrors: %q", values["mirrors"])
+	}
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
-	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -20,11 +20,16 @@ import (
 )
 
 const (
-	//githubAPIURL = "https://api.github.com/repos/hasura/ddn/releases"
+	// legacyInstallDir is the store under the home directory used before the XDG layout
+	legacyInstallDir = ".ddnswitch"
+	binName          = "ddn"
+)
+
+// releasesURL is the default release index, a variable so tests can point it
+// at a local server. Other sources are selected with --source.
+var (
 	//releasesURL = "https://gist.githubusercontent.com/shukla2112/7cab141a3eafab4d4565d7347eec9029/raw/d49a91cc321133ccac15f17ad09f749d6bec37c3/releases.json"
 	releasesURL = "https://gist.githubusercontent.com/shukla2112/7cab141a3eafab4d4565d7347eec9029/raw/releases.json"
-	installDir  = ".ddnswitch"
-	binName     = "ddn"
 )
 
 type Release struct {
@@ -33,11 +38,14 @@ type Release struct {
 	Assets     []Asset `json:"assets"`
 	PreRelease bool    `json:"prerelease"`
 	Draft      bool    `json:"draft"`
+	// localOnly marks an installed version standing in for a missing index
+	localOnly bool
 }
 
 type Asset struct {
 	Name               string `json:"name"`
 	BrowserDownloadURL string `json:"browser_download_url"`
+	Digest             string `json:"digest"` // "sha256:<hex>", as published by GitHub
 }
 
 func getHomeDir() (string, error) {
@@ -50,11 +58,15 @@ func getHomeDir() (string, error) {
 
 // Define getInstallDir as a variable of function type
 var getInstallDir = func() (string, error) {
-	home, err := getHomeDir()
+	if configuredInstallDir != "" {
+		return configuredInstallDir, nil
+	}
+	dataDir, err := defaultDataDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, installDir), nil
+	migrateLegacyStoreOnce(dataDir)
+	return dataDir, nil
 }
 
 func ensureInstallDir() error {
@@ -70,8 +82,8 @@ var (
 	versionCache     []Release
 	versionCacheMux  sync.RWMutex
 	versionCacheTime time.Time
-	cacheTTL         = 1 * time.Hour
-	cachePrerelease  bool // Store whether the cache includes prereleases
+	cacheTTL         = 1 * time.Hour // also how long the on-disk index is served without revalidating
+	cachePrerelease  bool            // Store whether the cache includes prereleases
 )
 
 func fetchAvailableVersions() ([]Release, error) {
@@ -84,31 +96,19 @@ func fetchAvailableVersions() ([]Release, error) {
 	}
 	versionCacheMux.RUnlock()
 
-	// Set a timeout for the HTTP request
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", releasesURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-	}
-
-	resp, err := client.Do(req)
+	// Serve from the on-disk cache or refresh it with a conditional request
+	body, err := loadReleaseIndex()
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch releases: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Releases API returned status: %d", resp.StatusCode)
+		if !offlineMode {
+			return nil, err
+		}
+		// Without any index, offline mode still knows what is installed
+		debugLog("Release index unavailable offline, using installed versions: %v", err)
+		return installedReleases()
 	}
 
 	var releases []Release
-	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+	if err := json.Unmarshal(body, &releases); err != nil {
 		return nil, fmt.Errorf("failed to decode releases: %w", err)
 	}
 
@@ -162,38 +162,6 @@ func debugCacheStatus() {
 	fmt.Printf("  Cache valid: %v\n", cacheValid)
 }
 
-func listAvailableVersions() error {
-	fmt.Println("Fetching available DDN CLI versions...")
-
-	// Uncomment this line for debugging
-	// debugCacheStatus()
-
-	releases, err := fetchAvailableVersions()
-	if err != nil {
-		return err
-	}
-
-	// Uncomment this line for debugging
-	// debugCacheStatus()
-
-	fmt.Println("\nAvailable DDN CLI versions:")
-	for i, release := range releases {
-		current := ""
-		if isCurrentVersion(release.TagName) {
-			current = " (current)"
-		}
-
-		prerelease := ""
-		if release.PreRelease {
-			prerelease = " [pre-release]"
-		}
-
-		fmt.Printf("%2d. %s%s%s\n", i+1, release.TagName, prerelease, current)
-	}
-
-	return nil
-}
-
 func listAndSelectVersion() error {
 	fmt.Println("Fetching available DDN CLI versions...")
 
@@ -207,10 +175,20 @@ func listAndSelectVersion() error {
 	}
 
 	// Prepare options for selection
+	active := activeVersion()
 	var options []string
 	for _, release := range releases {
+		installed := isVersionInstalled(release.TagName)
+		// Offline, only offer versions that can be switched to without a download
+		if offlineMode && !installed {
+			continue
+		}
+		if !installed && !releaseInstallable(release, runtime.GOOS, runtime.GOARCH) {
+			continue
+		}
+
 		current := ""
-		if isCurrentVersion(release.TagName) {
+		if release.TagName == active {
 			current = " (current)"
 		}
 
@@ -222,6 +200,10 @@ func listAndSelectVersion() error {
 		options = append(options, fmt.Sprintf("%s%s%s", release.TagName, prerelease, current))
 	}
 
+	if len(options) == 0 {
+		return fmt.Errorf("no DDN CLI versions are installed and ddnswitch is offline")
+	}
+
 	// Interactive selection
 	var selectedOption string
 	prompt := &survey.Select{
@@ -242,14 +224,116 @@ func listAndSelectVersion() error {
 func switchToVersion(version string) error {
 	debugLog("Starting switchToVersion for %s", version)
 
-	if err := ensureInstallDir(); err != nil {
+	// Resolve constraints like "~3.0" or "latest" to a concrete tag
+	resolved, err := resolveVersion(version)
+	if err != nil {
+		return err
+	}
+	version = resolved
+
+	binPath, err := prepareVersion(version)
+	if err != nil {
 		return err
 	}
 
+	// Get the symlink path
+	symlinkPath, err := getSymlinkPath()
+	if err != nil {
+		return fmt.Errorf("failed to determine symlink path: %w", err)
+	}
+	debugLog("Symlink path is %s", symlinkPath)
+
+	// With the shim installed there is no global link to repoint
+	if isShimLink(symlinkPath) {
+		if err := writeDefaultVersion(version); err != nil {
+			return fmt.Errorf("failed to record default version: %w", err)
+		}
+		fmt.Printf("Default DDN CLI version set to %s (dispatched by the shim at %s)\n", version, symlinkPath)
+		if err := recordDefaultSwitch(version); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record switch: %v\n", err)
+		}
+		return nil
+	}
+
+	// Check if symlink exists and where it points
+	if target, err := os.Readlink(symlinkPath); err == nil {
+		debugLog("Current symlink points to %s", target)
+		if target == binPath {
+			debugLog("Symlink already points to the correct version")
+			fmt.Printf("Already using DDN CLI version %s\n", version)
+			if err := writeDefaultVersion(version); err != nil {
+				return fmt.Errorf("failed to record default version: %w", err)
+			}
+			if _, ok := activeFromState(symlinkPath); !ok {
+				if err := recordActive(version, symlinkPath, false); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to record active version: %v\n", err)
+				}
+			}
+			return nil
+		}
+	} else {
+		debugLog("Failed to read symlink: %v", err)
+	}
+
+	// Remember the previous target so a bad switch can be rolled back
+	previousTarget, _ := os.Readlink(symlinkPath)
+
+	// Create or update symlink
+	debugLog("Creating symlink from %s to %s", symlinkPath, binPath)
+	if err := createSymlink(binPath); err != nil {
+		return fmt.Errorf("failed to create symlink for version %s: %w", version, err)
+	}
+
+	// Verify the symlink is working correctly
+	if err := checkBinaryVersion(symlinkPath, version); err != nil {
+		debugLog("Verification through %s failed: %v", symlinkPath, err)
+		if errors.Is(err, errVersionMismatch) {
+			return rollbackSymlink(symlinkPath, previousTarget, err)
+		}
+		return rollbackSymlink(symlinkPath, previousTarget,
+			fmt.Errorf("DDN CLI %s failed to run after switching: %w", version, err))
+	}
+
+	// Only a version that passed verification becomes the global default
+	// used by the shim, `shim uninstall` and `doctor --fix`
+	if err := writeDefaultVersion(version); err != nil {
+		return fmt.Errorf("failed to record default version: %w", err)
+	}
+
+	fmt.Printf("Verified: Active DDN CLI is now version %s\n", version)
+	if err := recordSwitch(version, symlinkPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record active version: %v\n", err)
+	}
+	warnIfShadowed(symlinkPath)
+	return nil
+}
+
+// rollbackSymlink points the link back at its previous target after a failed
+// switch and returns cause
+func rollbackSymlink(symlinkPath, previousTarget string, cause error) error {
+	if previousTarget == "" {
+		debugLog("No previous symlink target to roll back to")
+		return cause
+	}
+
+	fmt.Printf("Switch failed, restoring %s -> %s\n", symlinkPath, previousTarget)
+	if err := createSymlink(previousTarget); err != nil {
+		return fmt.Errorf("%w (rollback to %s also failed: %v)", cause, previousTarget, err)
+	}
+	return fmt.Errorf("%w; rolled back to %s", cause, previousTarget)
+}
+
+// prepareVersion makes sure version is installed and working, installing or
+// reinstalling it as needed, and returns the path of its binary
+func prepareVersion(version string) (string, error) {
+	if err := ensureInstallDir(); err != nil {
+		return "", err
+	}
+
 	// Get install directory
 	installPath, err := getInstallDir()
 	if err != nil {
-		return err
+		return "", err
 	}
 	debugLog("Install directory is %s", installPath)
 
@@ -265,7 +349,7 @@ func switchToVersion(version string) error {
 	if _, err := os.Stat(binPath); os.IsNotExist(err) {
 		fmt.Printf("Version %s not found locally. Installing...\n", version)
 		if err := installVersion(version); err != nil {
-			return fmt.Errorf("failed to install version %s: %w", version, err)
+			return "", fmt.Errorf("failed to install version %s: %w", version, err)
 		}
 	} else {
 		debugLog("Binary exists at %s", binPath)
@@ -284,76 +368,39 @@ func switchToVersion(version string) error {
 			}
 		}
 
-		// Verify the binary version
-		cmd := exec.Command(binPath, "version")
-		output, err := cmd.CombinedOutput() // Use CombinedOutput to capture stderr too
+		// Never run bytes that don't match the lock file
+		locked, lockPath, err := lockedBinary(version)
 		if err != nil {
-			debugLog("Failed to execute binary: %v", err)
-			debugLog("Command output: %s", string(output))
-			fmt.Printf("Reinstalling version %s due to verification failure\n", version)
-			if err := installVersion(version); err != nil {
-				return fmt.Errorf("failed to reinstall version %s: %w", version, err)
-			}
-		} else {
-			installedVersion := strings.TrimSpace(string(output))
-			debugLog("Binary reports version: %s", installedVersion)
-
-			if !strings.Contains(installedVersion, version) {
-				debugLog("Version mismatch! Expected %s, got %s", version, installedVersion)
-				fmt.Printf("Reinstalling version %s due to version mismatch\n", version)
+			return "", err
+		}
+		if locked != nil {
+			if err := verifyFileChecksum(binPath, locked.SHA256); err != nil {
+				debugLog("Lock verification failed: %v", err)
+				fmt.Printf("Reinstalling version %s due to checksum mismatch with %s\n", version, lockPath)
 				if err := installVersion(version); err != nil {
-					return fmt.Errorf("failed to reinstall version %s: %w", version, err)
+					return "", fmt.Errorf("failed to reinstall version %s: %w", version, err)
 				}
-			} else {
-				debugLog("Version verification successful")
+				return binPath, nil
 			}
 		}
-	}
-
-	// Get the symlink path
-	symlinkPath, err := getSymlinkPath()
-	if err != nil {
-		return fmt.Errorf("failed to determine symlink path: %w", err)
-	}
-	debugLog("Symlink path is %s", symlinkPath)
-
-	// Check if symlink exists and where it points
-	if target, err := os.Readlink(symlinkPath); err == nil {
-		debugLog("Current symlink points to %s", target)
-		if target == binPath {
-			debugLog("Symlink already points to the correct version")
-			fmt.Printf("Already using DDN CLI version %s\n", version)
-			return nil
-		}
-	} else {
-		debugLog("Failed to read symlink: %v", err)
-	}
-
-	// Create or update symlink
-	debugLog("Creating symlink from %s to %s", symlinkPath, binPath)
-	if err := createSymlink(binPath); err != nil {
-		return fmt.Errorf("failed to create symlink for version %s: %w", version, err)
-	}
 
-	// Verify the symlink is working correctly
-	cmd := exec.Command("ddn", "version")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		debugLog("Failed to execute ddn command: %v", err)
-		debugLog("Command output: %s", string(output))
-	} else {
-		activeVersion := strings.TrimSpace(string(output))
-		debugLog("Active ddn reports version: %s", activeVersion)
-
-		if !strings.Contains(activeVersion, version) {
-			fmt.Printf("WARNING: Active DDN CLI reports version %s, expected %s\n",
-				activeVersion, version)
+		// Verify the binary version
+		if err := checkBinaryVersion(binPath, version); err != nil {
+			debugLog("Verification failed: %v", err)
+			reason := "verification failure"
+			if errors.Is(err, errVersionMismatch) {
+				reason = "version mismatch"
+			}
+			fmt.Printf("Reinstalling version %s due to %s\n", version, reason)
+			if err := installVersion(version); err != nil {
+				return "", fmt.Errorf("failed to reinstall version %s: %w", version, err)
+			}
 		} else {
-			fmt.Printf("Verified: Active DDN CLI is now version %s\n", version)
+			debugLog("Version verification successful")
 		}
 	}
 
-	return nil
+	return binPath, nil
 }
 
 var installVersion = func(version string) error {
@@ -373,11 +420,10 @@ func installVersionImpl(version string) error {
 	debugLog("Platform: %s, Architecture: %s", osName, archName)
 
 	// ARM-based Linux systems are not supported
-	if osName == "linux" && (archName == "arm64" || archName == "arm") {
-		return fmt.Errorf("DDN CLI does not support ARM-based Linux systems")
+	if !isSupportedPlatform(osName, archName) {
+		return withCode(codeUnsupportedPlatform, fmt.Errorf("DDN CLI does not support ARM-based Linux systems"))
 	}
 
-	// Clean up any existing installation for this version
 	installPath, err := getInstallDir()
 	if err != nil {
 		return err
@@ -386,74 +432,111 @@ func installVersionImpl(version string) error {
 	versionDir := filepath.Join(installPath, version)
 	debugLog("Version directory: %s", versionDir)
 
-	if _, err := os.Stat(versionDir); err == nil {
-		debugLog("Removing existing version directory")
-		if err := os.RemoveAll(versionDir); err != nil {
-			debugLog("Failed to remove existing directory: %v", err)
-			return fmt.Errorf("failed to clean up existing installation: %w", err)
+	if offlineMode {
+		return offlineDownloadError(version)
+	}
+
+	// Serialize installs of the same version across processes
+	release, waited, err := lockVersion(version)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Another process installed this version while we waited, so reuse it,
+	// unless a lock file says it isn't the expected binary
+	if waited {
+		installedBin := filepath.Join(versionDir, binName)
+		if runtime.GOOS == "windows" {
+			installedBin += ".exe"
+		}
+		if binaryReportsVersion(installedBin, version) {
+			if err := checkLockedBinary(version, installedBin); err != nil {
+				debugLog("Not reusing %s: %v", installedBin, err)
+			} else {
+				fmt.Printf("DDN CLI %s was installed by another process\n", version)
+				return nil
+			}
 		}
 	}
 
-	debugLog("Creating version directory")
-	if err := os.MkdirAll(versionDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory for version %s: %w", version, err)
+	// Download into a staging directory so a failed or interrupted install
+	// never destroys a working version
+	stagingDir, err := createStagingDir(installPath, version)
+	if err != nil {
+		return err
 	}
+	defer os.RemoveAll(stagingDir)
+	debugLog("Staging directory: %s", stagingDir)
 
-	suffix := fmt.Sprintf("-%s-%s", osName, archName)
-	downloadURL := fmt.Sprintf("https://graphql-engine-cdn.hasura.io/ddn/cli/v4/%s/cli-ddn%s", version, suffix)
-	debugLog("Download URL: %s", downloadURL)
+	// A lock file pins both the URL and the expected bytes
+	locked, lockPath, err := lockedBinary(version)
+	if err != nil {
+		return err
+	}
+	if locked != nil {
+		debugLog("Verifying checksum against %s", lockPath)
+	}
 
-	binPath := filepath.Join(versionDir, binName)
+	binPath := filepath.Join(stagingDir, binName)
 	if runtime.GOOS == "windows" {
 		binPath += ".exe"
 	}
-	debugLog("Binary path: %s", binPath)
+	debugLog("Staged binary path: %s", binPath)
 
-	// Download the binary directly
-	debugLog("Downloading binary")
-	if err := downloadBinary(downloadURL, binPath); err != nil {
+	// Try the preferred URL first and fall back to the mirrors
+	candidates := downloadCandidates(version, osName, archName, locked)
+	debugLog("Download URLs: %v", candidates)
+	// Looking up the index asset goes offline when the network is down
+	if offlineMode {
+		return offlineDownloadError(version)
+	}
+	if _, err := downloadFromCandidates(version, candidates, binPath, locked); err != nil {
 		return fmt.Errorf("failed to download binary for version %s: %w", version, err)
 	}
 
 	// Verify the downloaded binary
 	debugLog("Verifying downloaded binary")
-	cmd := exec.Command(binPath, "version")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		debugLog("Failed to execute binary: %v", err)
-		debugLog("Command output: %s", string(output))
+	if err := checkBinaryVersion(binPath, version); err != nil {
+		if errors.Is(err, errVersionMismatch) {
+			return fmt.Errorf("downloaded binary does not match: %w", err)
+		}
 		return fmt.Errorf("failed to verify downloaded binary: %w", err)
 	}
 
-	installedVersion := strings.TrimSpace(string(output))
-	debugLog("Binary reports version: %s", installedVersion)
-
-	if !strings.Contains(installedVersion, version) {
-		debugLog("Version mismatch! Expected %s, got %s", version, installedVersion)
-		return fmt.Errorf("downloaded binary reports version %s, expected %s",
-			installedVersion, version)
+	// Only now replace the installed version
+	debugLog("Promoting %s to %s", stagingDir, versionDir)
+	if err := promoteStagingDir(stagingDir, versionDir); err != nil {
+		return fmt.Errorf("failed to install version %s: %w", version, err)
 	}
 
 	fmt.Printf("Successfully installed DDN CLI %s\n", version)
 	return nil
 }
 
-var downloadBinary = func(url, destPath string) error {
-	return downloadBinaryImpl(url, destPath)
+// binaryReportsVersion reports whether the binary runs and reports version
+func binaryReportsVersion(binPath, version string) bool {
+	if err := checkBinaryVersion(binPath, version); err != nil {
+		debugLog("%v", err)
+		return false
+	}
+	return true
 }
 
-func downloadBinaryImpl(url, destPath string) error {
+var downloadBinary = func(url, destPath, expectedSHA256 string) error {
+	return downloadBinaryImpl(url, destPath, expectedSHA256)
+}
+
+// downloadBinaryImpl downloads url to destPath. When expectedSHA256 is set the
+// data is hashed while streaming and the file is deleted on a mismatch.
+func downloadBinaryImpl(url, destPath, expectedSHA256 string) error {
 	fmt.Printf("Downloading from: %s\n", url)
 
-	resp, err := http.Get(url)
+	body, size, err := openDownload(url)
 	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download: HTTP status %d", resp.StatusCode)
+		return err
 	}
+	defer body.Close()
 
 	// Create destination file
 	outFile, err := os.Create(destPath)
@@ -464,16 +547,29 @@ func downloadBinaryImpl(url, destPath string) error {
 
 	// Create a progress reader
 	progressReader := &progressReader{
-		reader: resp.Body,
-		size:   resp.ContentLength,
+		reader: body,
+		size:   size,
 	}
 
-	// Copy the binary data to the file
-	_, err = io.Copy(outFile, progressReader)
+	// Copy the binary data to the file, hashing it on the way
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(outFile, hasher), progressReader)
 	if err != nil {
+		outFile.Close()
+		os.Remove(destPath)
 		return fmt.Errorf("failed to write binary data: %w", err)
 	}
 
+	if expectedSHA256 != "" {
+		actual := hex.EncodeToString(hasher.Sum(nil))
+		if !strings.EqualFold(actual, expectedSHA256) {
+			outFile.Close()
+			os.Remove(destPath)
+			return withCode(codeChecksumMismatch, fmt.Errorf("checksum mismatch: expected SHA-256 %s, got %s; the download was deleted", expectedSHA256, actual))
+		}
+		debugLog("Checksum verified: %s", actual)
+	}
+
 	// Make executable on Unix systems
 	if runtime.GOOS != "windows" {
 		if err := os.Chmod(destPath, 0755); err != nil {
@@ -493,24 +589,47 @@ func createSymlink(targetPath string) error {
 		return err
 	}
 
+	if err := createSymlinkAt(symlinkPath, targetPath); err != nil {
+		return err
+	}
+
+	// Later switches, current and the shim keep using this location
+	if err := recordLinkPath(symlinkPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record link location: %v\n", err)
+	}
+	return nil
+}
+
+// createSymlinkAt atomically points the link at symlinkPath to targetPath
+func createSymlinkAt(symlinkPath, targetPath string) error {
 	debugLog("Symlink path: %s", symlinkPath)
 
-	// Remove existing symlink if it exists
-	if _, err := os.Lstat(symlinkPath); err == nil {
-		debugLog("Removing existing symlink or file")
-		if err := os.Remove(symlinkPath); err != nil {
-			debugLog("Failed to remove existing symlink: %v", err)
-			return fmt.Errorf("failed to remove existing symlink: %w", err)
-		}
+	// The directory may be on PATH without existing yet (e.g. ~/bin)
+	if err := os.MkdirAll(filepath.Dir(symlinkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create symlink directory: %w", err)
 	}
 
-	// Create new symlink
-	debugLog("Creating new symlink")
-	if err := os.Symlink(targetPath, symlinkPath); err != nil {
+	// Build the new link under a temporary name in the same directory and
+	// rename it over the old one, so ddn never disappears from PATH
+	tmpPath := filepath.Join(filepath.Dir(symlinkPath), fmt.Sprintf(".%s.tmp-%d", filepath.Base(symlinkPath), os.Getpid()))
+	os.Remove(tmpPath)
+
+	debugLog("Creating new symlink at %s", tmpPath)
+	if err := os.Symlink(targetPath, tmpPath); err != nil {
 		debugLog("Failed to create symlink: %v", err)
 		// On Windows or if symlink fails, try copying the file
 		debugLog("Falling back to file copy")
-		return copyFile(targetPath, symlinkPath)
+		if err := copyFile(targetPath, tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	debugLog("Renaming %s to %s", tmpPath, symlinkPath)
+	if err := os.Rename(tmpPath, symlinkPath); err != nil {
+		debugLog("Failed to replace existing symlink: %v", err)
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace existing symlink: %w", err)
 	}
 
 	// Verify the symlink was created correctly
@@ -554,27 +673,39 @@ func copyFile(src, dst string) error {
 }
 
 func showCurrentVersion() error {
-	// Try to get version from currently active DDN CLI
-	cmd := exec.Command("ddn", "--version")
-	output, err := cmd.Output()
+	// Ask the ddn we manage, which is not necessarily the first one in PATH
+	symlinkPath, err := getSymlinkPath()
 	if err != nil {
-		fmt.Println("No DDN CLI found in PATH or unable to determine version")
+		return fmt.Errorf("failed to determine symlink path: %w", err)
+	}
+	if _, err := os.Stat(symlinkPath); err != nil {
+		fmt.Printf("No DDN CLI linked at %s\n", symlinkPath)
 		return nil
 	}
 
-	fmt.Printf("Current DDN CLI version: %s", strings.TrimSpace(string(output)))
-	return nil
-}
+	// The last switch knows what it linked, unless the link was changed since
+	if state, ok := activeFromState(symlinkPath); ok {
+		fmt.Printf("Current DDN CLI version: %s\n", state.Active)
+		fmt.Printf("Switched on %s\n", state.SwitchedAt.Local().Format("2006-01-02 15:04:05"))
+		warnIfShadowed(symlinkPath)
+		return nil
+	}
 
-func isCurrentVersion(version string) bool {
-	cmd := exec.Command("ddn", "--version")
-	output, err := cmd.Output()
+	reported, err := probeVersion(symlinkPath)
 	if err != nil {
-		return false
+		debugLog("%v", err)
+		fmt.Printf("Unable to determine the version of %s\n", symlinkPath)
+		return nil
 	}
 
-	currentVersion := strings.TrimSpace(string(output))
-	return strings.Contains(currentVersion, version)
+	fmt.Printf("Current DDN CLI version: v%s\n", reported.String())
+	warnIfShadowed(symlinkPath)
+	return nil
+}
+
+// isCurrentVersion reports whether version is the active version
+func isCurrentVersion(version string) bool {
+	return version != "" && activeVersion() == version
 }
 
 func uninstallVersion(version string) error {
@@ -586,8 +717,15 @@ func uninstallVersion(version string) error {
 	versionDir := filepath.Join(installPath, version)
 
 	if _, err := os.Stat(versionDir); os.IsNotExist(err) {
-		return fmt.Errorf("version %s is not installed", version)
+		return withCode(codeNotInstalled, fmt.Errorf("version %s is not installed", version))
+	}
+
+	// Don't pull a version out from under a concurrent install
+	release, _, err := lockVersion(version)
+	if err != nil {
+		return err
 	}
+	defer release()
 
 	if err := os.RemoveAll(versionDir); err != nil {
 		return fmt.Errorf("failed to uninstall version %s: %w", version, err)
@@ -618,18 +756,19 @@ func (pr *progressReader) Read(p []byte) (int, error) {
 
 // Helper function to get the symlink path
 var getSymlinkPath = func() (string, error) {
-	homeDir, err := getHomeDir()
+	binDir, source, err := resolveBinDir()
 	if err != nil {
 		return "", err
 	}
-	return getSymlinkPathImpl(homeDir)
+	debugLog("Using bin directory %s (%s)", binDir, source)
+	return filepath.Join(binDir, linkFileName()), nil
 }
 
-func getSymlinkPathImpl(homeDir string) (string, error) {
-	// Find a directory in PATH to create symlink
-	pathDirs := strings.Split(os.Getenv("PATH"), string(os.PathListSeparator))
+// guessBinDir picks a directory for the ddn link when none is configured or
+// recorded: the first well-known user bin directory on PATH, or ~/bin
+func guessBinDir(homeDir string) (string, error) {
+	pathDirs := filepath.SplitList(os.Getenv("PATH"))
 
-	var symlinkDir string
 	preferredDirs := []string{
 		filepath.Join(homeDir, "bin"),
 		filepath.Join(homeDir, ".local", "bin"),
@@ -639,44 +778,15 @@ func getSymlinkPathImpl(homeDir string) (string, error) {
 	for _, preferred := range preferredDirs {
 		for _, pathDir := range pathDirs {
 			if pathDir == preferred {
-				symlinkDir = pathDir
 				debugLog("Found preferred directory in PATH: %s", preferred)
-				goto found
+				return pathDir, nil
 			}
 		}
 	}
 
-	// If no preferred directory found, use first writable directory in PATH
-	for _, pathDir := range pathDirs {
-		if pathDir == "" || pathDir == "." {
-			continue
-		}
-
-		// Test if directory is writable
-		testFile := filepath.Join(pathDir, ".ddnswitch_test")
-		if file, err := os.Create(testFile); err == nil {
-			file.Close()
-			os.Remove(testFile)
-			symlinkDir = pathDir
-			debugLog("Found writable directory in PATH: %s", pathDir)
-			break
-		}
-	}
-
-found:
-	if symlinkDir == "" {
-		// Create ~/bin if no suitable directory found
-		symlinkDir = filepath.Join(homeDir, "bin")
-		debugLog("No suitable directory found in PATH, using %s", symlinkDir)
-		if err := os.MkdirAll(symlinkDir, 0755); err != nil {
-			return "", err
-		}
-	}
-
-	symlinkPath := filepath.Join(symlinkDir, binName)
-	if runtime.GOOS == "windows" {
-		symlinkPath += ".exe"
-	}
-
-	return symlinkPath, nil
+	// The link is only created here when something is switched, so nothing
+	// needs to exist yet
+	symlinkDir := filepath.Join(homeDir, "bin")
+	debugLog("No preferred directory found in PATH, using %s", symlinkDir)
+	return symlinkDir, nil
 }
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	cacheDirName = "cache"
+	// Files making up the cached release index
+	indexCacheFile          = "index.json"
+	indexSignatureCacheFile = "index.json" + indexSignatureSuffix
+	indexMetaCacheFile      = "index.meta.json"
+)
+
+// indexCacheMeta records where a cached index came from and the validators
+// needed to revalidate it with a conditional request
+type indexCacheMeta struct {
+	Source       string    `json:"source"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// cachedIndex is the release index as stored on disk
+type cachedIndex struct {
+	meta      indexCacheMeta
+	body      []byte
+	signature []byte
+}
+
+// getCacheDir returns the directory holding the on-disk release index cache
+var getCacheDir = func() (string, error) {
+	return defaultCacheDir()
+}
+
+// readCachedIndex loads the cached index, returning nil when there is none
+func readCachedIndex() (*cachedIndex, error) {
+	cacheDir, err := getCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	metaData, err := os.ReadFile(filepath.Join(cacheDir, indexMetaCacheFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &cachedIndex{}
+	if err := json.Unmarshal(metaData, &cached.meta); err != nil {
+		return nil, fmt.Errorf("invalid cache metadata: %w", err)
+	}
+
+	if cached.body, err = os.ReadFile(filepath.Join(cacheDir, indexCacheFile)); err != nil {
+		return nil, err
+	}
+
+	cached.signature, err = os.ReadFile(filepath.Join(cacheDir, indexSignatureCacheFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return cached, nil
+}
+
+// writeCachedIndex stores the index, its signature and metadata. The metadata
+// goes last so a half-written cache is never considered valid.
+func writeCachedIndex(cached *cachedIndex) error {
+	cacheDir, err := getCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(cacheDir, indexCacheFile), cached.body); err != nil {
+		return err
+	}
+
+	signaturePath := filepath.Join(cacheDir, indexSignatureCacheFile)
+	if len(cached.signature) > 0 {
+		if err := writeFileAtomic(signaturePath, cached.signature); err != nil {
+			return err
+		}
+	} else if err := os.Remove(signaturePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return writeCacheMeta(cacheDir, cached.meta)
+}
+
+func writeCacheMeta(cacheDir string, meta indexCacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cacheDir, indexMetaCacheFile), append(data, '\n'))
+}
+
+// writeFileAtomic writes through a temp file so concurrent readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// loadReleaseIndex returns the raw release index of the configured source. A
+// cached copy is served without touching the network while it is younger than
+// cacheTTL; after that it is revalidated with If-None-Match / If-Modified-Since.
+func loadReleaseIndex() ([]byte, error) {
+	source, err := currentReleaseSource()
+	if err != nil {
+		return nil, err
+	}
+	debugLog("Release source: %s", source)
+
+	if !source.Cacheable() {
+		resp, err := source.Fetch(nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := checkIndexSignature(source, resp.body); err != nil {
+			return nil, err
+		}
+		return resp.body, nil
+	}
+
+	cached, err := readCachedIndex()
+	if err != nil {
+		debugLog("Ignoring unreadable release index cache: %v", err)
+		cached = nil
+	}
+	if cached != nil && cached.meta.Source != source.String() {
+		debugLog("Cached release index is for %s, not %s", cached.meta.Source, source)
+		cached = nil
+	}
+	// The cache is as trusted as the network, so its signature is checked too
+	if cached != nil {
+		if err := checkCachedIndexSignature(cached.body, cached.signature); err != nil {
+			debugLog("Discarding cached release index: %v", err)
+			cached = nil
+		}
+	}
+
+	if cached != nil {
+		age := time.Since(cached.meta.FetchedAt)
+		if age >= 0 && age < cacheTTL {
+			debugLog("Using cached release index (age %v, TTL %v)", age.Round(time.Second), cacheTTL)
+			return cached.body, nil
+		}
+	}
+
+	// Offline, a stale index is still better than none
+	if offlineMode {
+		if cached == nil {
+			return nil, withCode(codeOffline, fmt.Errorf("no cached release index available in offline mode"))
+		}
+		debugLog("Offline, using cached release index from %s", cached.meta.FetchedAt)
+		return cached.body, nil
+	}
+
+	var validators *indexCacheMeta
+	if cached != nil {
+		validators = &cached.meta
+	}
+	resp, err := source.Fetch(validators)
+	if err != nil {
+		if !isNetworkError(err) {
+			return nil, err
+		}
+		goOffline(err)
+		if cached == nil {
+			return nil, err
+		}
+		return cached.body, nil
+	}
+
+	if resp.notModified {
+		debugLog("Release index not modified, refreshing cache timestamp")
+		cached.meta.FetchedAt = time.Now()
+		if cacheDir, err := getCacheDir(); err == nil {
+			if err := writeCacheMeta(cacheDir, cached.meta); err != nil {
+				debugLog("Failed to update release index cache: %v", err)
+			}
+		}
+		return cached.body, nil
+	}
+
+	// The index decides what we download and execute, so check its signature first
+	signature, err := checkIndexSignature(source, resp.body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeCachedIndex(&cachedIndex{
+		meta: indexCacheMeta{
+			Source:       source.String(),
+			ETag:         resp.etag,
+			LastModified: resp.lastModified,
+			FetchedAt:    time.Now(),
+		},
+		body:      resp.body,
+		signature: signature,
+	})
+	if err != nil {
+		// A read-only home shouldn't break listing versions
+		debugLog("Failed to write release index cache: %v", err)
+	}
+
+	return resp.body, nil
+}
+
+// printCacheInfo describes the on-disk release index cache, each line
+// starting with indent
+func printCacheInfo(indent string) error {
+	cacheDir, err := getCacheDir()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%sCache directory: %s\n", indent, cacheDir)
+	fmt.Printf("%sCache TTL: %v\n", indent, cacheTTL)
+
+	cached, err := readCachedIndex()
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+	if cached == nil {
+		fmt.Printf("%sRelease index: not cached\n", indent)
+		return nil
+	}
+
+	age := time.Since(cached.meta.FetchedAt)
+	status := "fresh"
+	if age >= cacheTTL {
+		status = "stale, will be revalidated on next use"
+	}
+
+	fmt.Printf("%sRelease index: %s\n", indent, cached.meta.Source)
+	fmt.Printf("%s  Size: %d bytes\n", indent, len(cached.body))
+	fmt.Printf("%s  Fetched: %s (%v ago, %s)\n", indent, cached.meta.FetchedAt.Local().Format(time.RFC1123), age.Round(time.Second), status)
+	if cached.meta.ETag != "" {
+		fmt.Printf("%s  ETag: %s\n", indent, cached.meta.ETag)
+	}
+	if cached.meta.LastModified != "" {
+		fmt.Printf("%s  Last-Modified: %s\n", indent, cached.meta.LastModified)
+	}
+	fmt.Printf("%s  Signed: %v\n", indent, len(cached.signature) > 0)
+	return nil
+}
+
+// clearCache removes the on-disk cache and forgets the in-memory one
+func clearCache() error {
+	cacheDir, err := getCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", cacheDir, err)
+	}
+
+	versionCacheMux.Lock()
+	versionCache = nil
+	versionCacheTime = time.Time{}
+	versionCacheMux.Unlock()
+
+	fmt.Printf("Cleared cache at %s\n", cacheDir)
+	return nil
+}
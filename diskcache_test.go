@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveReleaseIndex points releasesURL at a local server that supports ETags
+// and counts full downloads and 304 responses
+func serveReleaseIndex(t *testing.T, body string) (full, notModified *int) {
+	full, notModified = new(int), new(int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			*notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		*full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	originalReleasesURL := releasesURL
+	originalGetCacheDir := getCacheDir
+	cacheDir := t.TempDir()
+	releasesURL = server.URL + "/releases.json"
+	getCacheDir = func() (string, error) {
+		return cacheDir, nil
+	}
+	t.Cleanup(func() {
+		releasesURL = originalReleasesURL
+		getCacheDir = originalGetCacheDir
+	})
+	return full, notModified
+}
+
+func TestLoadReleaseIndexUsesDiskCache(t *testing.T) {
+	t.Setenv(indexPublicKeyEnvVar, "")
+	index := `[{"tag_name":"v2.28.0"}]`
+	full, notModified := serveReleaseIndex(t, index)
+
+	originalTTL := cacheTTL
+	defer func() {
+		cacheTTL = originalTTL
+	}()
+	cacheTTL = time.Hour
+
+	// The first load downloads and caches the index
+	body, err := loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Failed to load release index: %v", err)
+	}
+	if string(body) != index || *full != 1 {
+		t.Fatalf("Expected one download of the index, got %d (%q)", *full, body)
+	}
+
+	// Within the TTL the cache is served without a request
+	if _, err := loadReleaseIndex(); err != nil {
+		t.Fatalf("Failed to load cached release index: %v", err)
+	}
+	if *full != 1 || *notModified != 0 {
+		t.Fatalf("Expected no request within the TTL, got %d full and %d conditional", *full, *notModified)
+	}
+
+	// Once expired, the cache is revalidated with its ETag
+	cacheTTL = 0
+	body, err = loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Failed to revalidate release index: %v", err)
+	}
+	if string(body) != index || *full != 1 || *notModified != 1 {
+		t.Fatalf("Expected a 304 revalidation, got %d full and %d conditional", *full, *notModified)
+	}
+
+	cached, err := readCachedIndex()
+	if err != nil || cached == nil {
+		t.Fatalf("Failed to read cached index: %v", err)
+	}
+	if cached.meta.ETag != `"v1"` || time.Since(cached.meta.FetchedAt) > time.Minute {
+		t.Fatalf("Unexpected cache metadata after revalidation: %+v", cached.meta)
+	}
+}
+
+func TestLoadReleaseIndexIgnoresCacheForOtherURL(t *testing.T) {
+	t.Setenv(indexPublicKeyEnvVar, "")
+	full, _ := serveReleaseIndex(t, `[]`)
+
+	cacheDir, _ := getCacheDir()
+	err := writeCachedIndex(&cachedIndex{
+		meta: indexCacheMeta{Source: "https://example.com/other.json", FetchedAt: time.Now()},
+		body: []byte(`[{"tag_name":"v9.9.9"}]`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+
+	body, err := loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Failed to load release index: %v", err)
+	}
+	if string(body) != `[]` || *full != 1 {
+		t.Fatalf("Expected the index to be refetched, got %q", body)
+	}
+
+	// Clearing removes the whole cache directory
+	if err := clearCache(); err != nil {
+		t.Fatalf("Failed to clear cache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, indexCacheFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected cached index to be removed, got %v", err)
+	}
+}
+
+func TestLoadReleaseIndexRejectsTamperedCache(t *testing.T) {
+	index := []byte(`[{"tag_name":"v2.28.0"}]`)
+	publicKey, sign := minisignFixture(t)
+	signature := sign(index)
+	t.Setenv(indexPublicKeyEnvVar, publicKey)
+
+	full, _ := serveReleaseIndex(t, string(index))
+	originalFetchIndexSignature := fetchIndexSignature
+	defer func() {
+		fetchIndexSignature = originalFetchIndexSignature
+	}()
+	fetchIndexSignature = func(indexURL string) ([]byte, error) {
+		return signature, nil
+	}
+
+	err := writeCachedIndex(&cachedIndex{
+		meta:      indexCacheMeta{Source: releasesURL, FetchedAt: time.Now()},
+		body:      []byte(`[{"tag_name":"v6.6.6"}]`),
+		signature: signature,
+	})
+	if err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+
+	body, err := loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Failed to load release index: %v", err)
+	}
+	if string(body) != string(index) || *full != 1 {
+		t.Fatalf("Tampered cache was served: %q", body)
+	}
+}
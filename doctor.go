@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// doctorHTTPTimeout bounds each reachability check
+var doctorHTTPTimeout = 10 * time.Second
+
+// doctor collects the problems found by `ddnswitch doctor` and repairs the
+// safe ones when fix is set
+type doctor struct {
+	fix      bool
+	problems int
+	fixed    int
+}
+
+func (d *doctor) section(title string) {
+	fmt.Printf("\n%s\n", title)
+}
+
+func (d *doctor) info(format string, args ...interface{}) {
+	fmt.Printf("  %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Printf("  [ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+// problem reports an issue. repair is nil when there is no safe automatic fix.
+func (d *doctor) problem(level, message, fixDescription string, repair func() error) {
+	fmt.Printf("  [%s] %s\n", level, message)
+	if repair == nil {
+		d.problems++
+		return
+	}
+	if !d.fix {
+		d.problems++
+		fmt.Printf("         fix: %s (run `ddnswitch doctor --fix`)\n", fixDescription)
+		return
+	}
+	if err := repair(); err != nil {
+		d.problems++
+		fmt.Printf("         fix failed: %v\n", err)
+		return
+	}
+	d.fixed++
+	fmt.Printf("         fixed: %s\n", fixDescription)
+}
+
+func (d *doctor) warn(message, fixDescription string, repair func() error) {
+	d.problem("warn", message, fixDescription, repair)
+}
+
+func (d *doctor) fail(message, fixDescription string, repair func() error) {
+	d.problem("FAIL", message, fixDescription, repair)
+}
+
+// runDoctor checks the environment ddnswitch runs in and returns an error
+// when problems remain
+func runDoctor(fix bool) error {
+	d := &doctor{fix: fix}
+
+	// Links first, so the PATH listing reflects any repairs
+	d.checkLink()
+	d.checkDanglingLinks()
+	d.checkPath()
+	d.checkStore()
+	d.checkPins()
+	d.checkConfig()
+	d.checkNetwork()
+	d.checkCache()
+
+	fmt.Println()
+	if d.fixed > 0 {
+		fmt.Printf("Fixed %d problem(s)\n", d.fixed)
+	}
+	if d.problems > 0 {
+		return fmt.Errorf("%d problem(s) found", d.problems)
+	}
+	fmt.Println("No problems found")
+	return nil
+}
+
+// ddnOnPath returns every ddn executable in PATH, in the order the shell searches them
+func ddnOnPath() []string {
+	var found []string
+	seen := map[string]bool{}
+	for _, pathDir := range filepath.SplitList(os.Getenv("PATH")) {
+		if pathDir == "" || seen[filepath.Clean(pathDir)] {
+			continue
+		}
+		seen[filepath.Clean(pathDir)] = true
+		if candidate := filepath.Join(pathDir, linkFileName()); isExecutableFile(candidate) {
+			found = append(found, candidate)
+		}
+	}
+	return found
+}
+
+// inStore reports whether path is inside the install directory
+func inStore(path string) bool {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(filepath.Clean(path), filepath.Clean(installPath)+string(filepath.Separator))
+}
+
+func (d *doctor) checkPath() {
+	d.section("ddn in PATH")
+	found := ddnOnPath()
+	if len(found) == 0 {
+		d.warn("no ddn found in PATH", "", nil)
+		return
+	}
+	for i, path := range found {
+		description := path
+		if target, err := os.Readlink(path); err == nil {
+			description += " -> " + target
+		}
+		if i == 0 {
+			description += " (wins)"
+		}
+		d.info("%d. %s", i+1, description)
+	}
+}
+
+// relinkDefault returns a repair that points the managed link at the global
+// default version, or nil when that version isn't installed
+func relinkDefault() (string, func() error) {
+	version, err := readDefaultVersion()
+	if err != nil || version == "" {
+		return "", nil
+	}
+	binPath, err := versionBinPath(version)
+	if err != nil || !isExecutableFile(binPath) {
+		return "", nil
+	}
+	return "link ddn to the default version " + version, func() error {
+		return createSymlink(binPath)
+	}
+}
+
+func (d *doctor) checkLink() {
+	d.section("Managed link")
+	binDir, source, err := resolveBinDir()
+	if err != nil {
+		d.fail(fmt.Sprintf("failed to determine the link location: %v", err), "", nil)
+		return
+	}
+	symlinkPath := filepath.Join(binDir, linkFileName())
+	d.info("Location: %s (%s)", symlinkPath, source)
+
+	info, err := os.Lstat(symlinkPath)
+	switch {
+	case os.IsNotExist(err):
+		description, repair := relinkDefault()
+		d.warn(fmt.Sprintf("no ddn link at %s", symlinkPath), description, repair)
+		return
+	case err != nil:
+		d.fail(fmt.Sprintf("failed to inspect %s: %v", symlinkPath, err), "", nil)
+		return
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, _ := os.Readlink(symlinkPath)
+		if _, err := os.Stat(symlinkPath); err != nil {
+			description, repair := relinkDefault()
+			if repair == nil && inStore(target) {
+				description, repair = "remove the dangling link", func() error { return os.Remove(symlinkPath) }
+			}
+			d.fail(fmt.Sprintf("%s is dangling, it points to missing %s", symlinkPath, target), description, repair)
+			return
+		}
+		switch {
+		case isShimLink(symlinkPath):
+			d.ok("dispatches through the ddnswitch shim")
+		case inStore(target):
+			d.ok("points to %s", target)
+		default:
+			d.warn(fmt.Sprintf("%s points outside the store, to %s", symlinkPath, target), "", nil)
+		}
+	} else {
+		d.ok("%s is a copy of a DDN CLI binary", symlinkPath)
+	}
+
+	if shadows, onPath := shadowingBinaries(binDir); len(shadows) > 0 {
+		d.warn(fmt.Sprintf("shadowed by %s earlier in PATH", strings.Join(shadows, ", ")), "", nil)
+	} else if !onPath {
+		d.warn(fmt.Sprintf("%s is not in PATH", binDir), "", nil)
+	} else {
+		d.ok("%s is the ddn your shell runs", symlinkPath)
+	}
+}
+
+// checkDanglingLinks looks for ddn links in PATH whose target is gone, such
+// as links left behind by an uninstalled version
+func (d *doctor) checkDanglingLinks() {
+	d.section("Dangling links")
+	managed, _ := getSymlinkPath()
+	count := 0
+	for _, pathDir := range filepath.SplitList(os.Getenv("PATH")) {
+		if pathDir == "" {
+			continue
+		}
+		linkPath := filepath.Join(pathDir, linkFileName())
+		if linkPath == managed {
+			continue // reported with the managed link
+		}
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(linkPath); err == nil {
+			continue
+		}
+		count++
+		message := fmt.Sprintf("%s is dangling, it points to missing %s", linkPath, target)
+		if inStore(target) {
+			d.fail(message, "remove "+linkPath, func() error { return os.Remove(linkPath) })
+		} else {
+			d.warn(message, "", nil)
+		}
+	}
+	if count == 0 {
+		d.ok("no dangling ddn links in PATH")
+	}
+}
+
+func (d *doctor) checkStore() {
+	d.section("Installed versions")
+	installPath, err := getInstallDir()
+	if err != nil {
+		d.fail(fmt.Sprintf("failed to determine the install directory: %v", err), "", nil)
+		return
+	}
+	d.info("Store: %s", installPath)
+
+	entries, err := os.ReadDir(installPath)
+	if os.IsNotExist(err) {
+		d.info("No versions installed")
+		return
+	}
+	if err != nil {
+		d.fail(fmt.Sprintf("failed to read %s: %v", installPath, err), "", nil)
+		return
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		binPath, err := versionBinPath(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(binPath)
+		if err != nil {
+			d.warn(fmt.Sprintf("%s has no %s binary", entry.Name(), binName), "", nil)
+			continue
+		}
+		count++
+		if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+			path := binPath
+			d.fail(fmt.Sprintf("%s is not executable", binPath), "make it executable", func() error {
+				return os.Chmod(path, 0755)
+			})
+		}
+	}
+	d.info("%d version(s) installed", count)
+
+	if version, err := readDefaultVersion(); err == nil && version != "" {
+		if binPath, err := versionBinPath(version); err == nil && isExecutableFile(binPath) {
+			d.ok("default version %s is installed", version)
+		} else {
+			d.warn(fmt.Sprintf("default version %s is not installed", version), "", nil)
+		}
+	}
+}
+
+// checkPins reports everything that selects a version for the current directory
+func (d *doctor) checkPins() {
+	d.section("Version selection for this directory")
+	if spec := os.Getenv(versionEnvVar); spec != "" {
+		d.info("%s=%s", versionEnvVar, spec)
+	}
+
+	spec, pinPath, err := readPinSpec()
+	if err != nil {
+		d.fail(fmt.Sprintf("failed to read pin file: %v", err), "", nil)
+		return
+	}
+	if pinPath == "" {
+		d.info("No %s in this directory or any parent", pinFileName)
+	} else {
+		d.info("Pin file: %s (%s)", pinPath, spec)
+		lockPath := filepath.Join(filepath.Dir(pinPath), lockFileName)
+		if _, err := os.Stat(lockPath); err == nil {
+			d.info("Lock file: %s", lockPath)
+		}
+		if version, _, err := resolvePinnedVersion(); err != nil {
+			d.fail(fmt.Sprintf("failed to resolve pinned version: %v", err), "", nil)
+		} else if resolved, err := resolveInstalledVersion(version); err != nil || !isVersionInstalled(resolved) {
+			// Exact versions resolve without looking at the store
+			d.warn(fmt.Sprintf("pinned version %s is not installed; run `ddnswitch use`", spec), "", nil)
+		} else {
+			d.ok("pinned version %s is installed", spec)
+		}
+	}
+
+	if projectPath, err := projectConfigPath(); err == nil && projectPath != "" {
+		d.info("Project config: %s", projectPath)
+	}
+}
+
+func (d *doctor) checkConfig() {
+	d.section("Configuration")
+	if path, err := userConfigPath(); err == nil {
+		d.info("User config: %s", path)
+	}
+	printConfig("  ")
+
+	source, err := currentReleaseSource()
+	if err != nil {
+		d.fail(fmt.Sprintf("invalid release source: %v", err), "", nil)
+		return
+	}
+	d.info("Release source: %s", source)
+	d.info("Download URL: %s", downloadURLTemplate)
+	for _, mirror := range downloadMirrors {
+		d.info("Mirror: %s", mirror)
+	}
+}
+
+// reachable makes a HEAD request to rawURL. Any HTTP response counts, since
+// CDNs often refuse HEAD or directory requests.
+func reachable(rawURL string) (int, error) {
+	client := &http.Client{Timeout: doctorHTTPTimeout}
+	resp, err := client.Head(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// hostRoot returns the scheme and host of a URL template, or an empty
+// string for file:// URLs
+func hostRoot(template string) string {
+	u, err := url.Parse(template)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+func (d *doctor) checkNetwork() {
+	d.section("Network")
+	if offlineMode {
+		d.info("Skipped (offline mode)")
+		return
+	}
+
+	type target struct{ name, url string }
+	var targets []target
+
+	source, err := currentReleaseSource()
+	if err == nil {
+		switch s := source.(type) {
+		case *urlSource:
+			targets = append(targets, target{"release index", s.url})
+		case *githubSource:
+			targets = append(targets, target{"release index", fmt.Sprintf("%s/repos/%s/releases?per_page=1", githubAPIURL, s.repo)})
+		case *localSource:
+			if _, err := os.Stat(s.path); err != nil {
+				d.fail(fmt.Sprintf("release index %s is not readable: %v", s.path, err), "", nil)
+			} else {
+				d.ok("release index %s is readable", s.path)
+			}
+		}
+	}
+	for _, template := range append([]string{downloadURLTemplate}, downloadMirrors...) {
+		if root := hostRoot(template); root != "" {
+			targets = append(targets, target{"download host", root})
+		}
+	}
+
+	for _, t := range targets {
+		status, err := reachable(t.url)
+		if err != nil {
+			d.fail(fmt.Sprintf("%s %s is unreachable: %v", t.name, t.url, err), "", nil)
+			continue
+		}
+		d.ok("%s %s is reachable (HTTP %d)", t.name, t.url, status)
+	}
+}
+
+func (d *doctor) checkCache() {
+	d.section("Release index cache")
+	if err := printCacheInfo("  "); err != nil {
+		d.fail(err.Error(), "clear the cache", clearCache)
+	}
+}
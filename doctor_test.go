@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDoctorFixesSafeProblems(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	isolateConfig(t)
+	setOfflineMode(t, true)
+	chdirForTest(t, tempDir)
+
+	originalGetInstallDir := getInstallDir
+	originalGetCacheDir := getCacheDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getCacheDir = originalGetCacheDir
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	getCacheDir = func() (string, error) {
+		return filepath.Join(tempDir, "cache"), nil
+	}
+
+	installMockVersions(t, installDir, "v2.9.0", "v3.0.1")
+	if err := writeDefaultVersion("v3.0.1"); err != nil {
+		t.Fatalf("Failed to write default version: %v", err)
+	}
+	brokenBinary, _ := versionBinPath("v2.9.0")
+	if err := os.Chmod(brokenBinary, 0644); err != nil {
+		t.Fatalf("Failed to break binary: %v", err)
+	}
+
+	// The managed link points at an uninstalled version, and an old link
+	// elsewhere in PATH does too
+	binDir := filepath.Join(tempDir, "bin")
+	oldBinDir := filepath.Join(tempDir, "old-bin")
+	for _, dir := range []string{binDir, oldBinDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.Symlink(filepath.Join(installDir, "v1.0.0", binName), filepath.Join(dir, binName)); err != nil {
+			t.Fatalf("Failed to create dangling link: %v", err)
+		}
+	}
+	configuredBinDir = binDir
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+oldBinDir)
+
+	out, err := captureStdout(t, func() error {
+		return runDoctor(false)
+	})
+	if err == nil {
+		t.Fatalf("Expected doctor to report problems, got:\n%s", out)
+	}
+	for _, expected := range []string{"is dangling", "is not executable", "doctor --fix"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected %q in doctor output:\n%s", expected, out)
+		}
+	}
+
+	out, err = captureStdout(t, func() error {
+		return runDoctor(true)
+	})
+	if err != nil {
+		t.Fatalf("Expected --fix to repair everything, got %v:\n%s", err, out)
+	}
+
+	defaultBinary, _ := versionBinPath("v3.0.1")
+	if target, err := os.Readlink(filepath.Join(binDir, binName)); err != nil || target != defaultBinary {
+		t.Fatalf("Expected the managed link to point to the default version, got %s (%v)", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(oldBinDir, binName)); !os.IsNotExist(err) {
+		t.Fatal("Expected the dangling link into the store to be removed")
+	}
+	if !isExecutableFile(brokenBinary) {
+		t.Fatal("Expected the binary to be made executable")
+	}
+}
+
+func TestDoctorChecksReachability(t *testing.T) {
+	tempDir := t.TempDir()
+	isolateConfig(t)
+	setOfflineMode(t, false)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected a HEAD request, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	releaseSourceSpec = server.URL + "/releases.json"
+	downloadURLTemplate = "file://" + tempDir + "/{version}/ddn"
+	downloadMirrors = []string{"http://127.0.0.1:1/{version}/ddn"}
+
+	d := &doctor{}
+	out, _ := captureStdout(t, func() error {
+		d.checkNetwork()
+		return nil
+	})
+
+	// Any HTTP response means the host is reachable; file:// templates are skipped
+	if !strings.Contains(out, "release index "+server.URL+"/releases.json is reachable (HTTP 403)") {
+		t.Fatalf("Expected the index to be reachable:\n%s", out)
+	}
+	if !strings.Contains(out, "http://127.0.0.1:1/ is unreachable") || d.problems != 1 {
+		t.Fatalf("Expected only the mirror to be unreachable:\n%s", out)
+	}
+}
+
+func TestDoctorWarnsAboutUninstalledExactPin(t *testing.T) {
+	tempDir := t.TempDir()
+	isolateConfig(t)
+	setOfflineMode(t, true)
+	chdirForTest(t, tempDir)
+
+	originalGetInstallDir := getInstallDir
+	originalGetCacheDir := getCacheDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getCacheDir = originalGetCacheDir
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	getCacheDir = func() (string, error) {
+		return filepath.Join(tempDir, "cache"), nil
+	}
+	configuredBinDir = filepath.Join(tempDir, "bin")
+
+	installMockVersions(t, installDir, "v2.9.0")
+	if err := os.WriteFile(filepath.Join(tempDir, pinFileName), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+
+	out, _ := captureStdout(t, func() error {
+		return runDoctor(false)
+	})
+	if !strings.Contains(out, "pinned version v3.0.1 is not installed") || strings.Contains(out, "pinned version v3.0.1 is installed") {
+		t.Fatalf("Expected the uninstalled exact pin to be reported:\n%s", out)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// defaultDownloadURLTemplate is where DDN CLI binaries are published
+const defaultDownloadURLTemplate = "https://graphql-engine-cdn.hasura.io/ddn/cli/v4/{version}/cli-ddn-{os}-{arch}"
+
+var (
+	// downloadURLTemplate builds the download URL of a binary from {version},
+	// {os}, {arch} and {ext} (".exe" on Windows, empty elsewhere)
+	downloadURLTemplate = defaultDownloadURLTemplate
+	// downloadMirrors are URL templates tried in order when a download fails
+	downloadMirrors []string
+)
+
+// expandURLTemplate fills in the placeholders of a download URL template
+func expandURLTemplate(template, version, osName, archName string) string {
+	ext := ""
+	if osName == "windows" {
+		ext = ".exe"
+	}
+	return strings.NewReplacer(
+		"{version}", version,
+		"{os}", osName,
+		"{arch}", archName,
+		"{ext}", ext,
+	).Replace(template)
+}
+
+// binaryDownloadURL returns the preferred download URL of the DDN CLI binary for a platform
+func binaryDownloadURL(version, osName, archName string) string {
+	return downloadCandidates(version, osName, archName, nil)[0]
+}
+
+// downloadCandidates lists the URLs to try, in order: the locked URL or the
+// asset URL from the release index or the configured template, then the
+// mirrors. Duplicates are dropped.
+func downloadCandidates(version, osName, archName string, locked *LockedBinary) []string {
+	var primary []string
+	switch {
+	case locked != nil && locked.URL != "":
+		// The lock pins the bytes, so any mirror serving them is fine too
+		primary = []string{locked.URL}
+	default:
+		if asset := indexAsset(version, osName, archName); asset != nil && asset.BrowserDownloadURL != "" {
+			primary = append(primary, asset.BrowserDownloadURL)
+		}
+		primary = append(primary, expandURLTemplate(downloadURLTemplate, version, osName, archName))
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, candidate := range primary {
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	for _, mirror := range downloadMirrors {
+		candidate := expandURLTemplate(mirror, version, osName, archName)
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// indexAsset returns the release index entry of a platform's binary for
+// version, or nil when the index doesn't list it
+var indexAsset = func(version, osName, archName string) *Asset {
+	return indexAssetImpl(version, osName, archName)
+}
+
+func indexAssetImpl(version, osName, archName string) *Asset {
+	releases, err := fetchAvailableVersions()
+	if err != nil {
+		debugLog("Release index unavailable for asset lookup: %v", err)
+		return nil
+	}
+
+	for _, release := range releases {
+		if release.TagName == version {
+			return releaseAsset(release, osName, archName)
+		}
+	}
+	return nil
+}
+
+// releaseAsset returns the binary of release for a platform, or nil
+func releaseAsset(release Release, osName, archName string) *Asset {
+	name := assetName(osName, archName)
+	for _, asset := range release.Assets {
+		if asset.Name == name || asset.Name == strings.TrimSuffix(name, ".exe") {
+			asset := asset
+			return &asset
+		}
+	}
+	return nil
+}
+
+// isSupportedPlatform reports whether the DDN CLI is built for a platform at all
+func isSupportedPlatform(osName, archName string) bool {
+	return !(osName == "linux" && (archName == "arm64" || archName == "arm"))
+}
+
+// releaseInstallable reports whether release can be installed on a platform.
+// An index without assets can't tell, so the download is assumed to exist.
+func releaseInstallable(release Release, osName, archName string) bool {
+	if !isSupportedPlatform(osName, archName) {
+		return false
+	}
+	return len(release.Assets) == 0 || releaseAsset(release, osName, archName) != nil
+}
+
+// downloadFromCandidates downloads the binary from the first URL that works,
+// verifying each attempt against its expected checksum, and returns the URL used
+func downloadFromCandidates(version string, candidates []string, binPath string, locked *LockedBinary) (string, error) {
+	var errs []error
+	for i, downloadURL := range candidates {
+		if i > 0 {
+			fmt.Printf("Trying mirror %s\n", downloadURL)
+		}
+
+		// Work out which checksum the download has to match
+		expectedSHA256, err := expectedChecksum(version, downloadURL, locked)
+		if err != nil {
+			debugLog("No usable checksum for %s: %v", downloadURL, err)
+			errs = append(errs, fmt.Errorf("%s: %w", downloadURL, err))
+			continue
+		}
+
+		// Download the binary directly, verifying it while streaming
+		debugLog("Downloading binary from %s", downloadURL)
+		if err := downloadBinary(downloadURL, binPath, expectedSHA256); err != nil {
+			debugLog("Download from %s failed: %v", downloadURL, err)
+			errs = append(errs, fmt.Errorf("%s: %w", downloadURL, err))
+			continue
+		}
+		return downloadURL, nil
+	}
+
+	if len(errs) == 1 {
+		return "", errors.Unwrap(errs[0])
+	}
+	return "", fmt.Errorf("all %d download URLs failed: %w", len(candidates), errors.Join(errs...))
+}
+
+// openDownload opens an http(s) or file:// URL, returning its content and
+// size (-1 when unknown)
+func openDownload(downloadURL string) (io.ReadCloser, int64, error) {
+	if strings.HasPrefix(downloadURL, "file://") {
+		path, err := fileURLPath(downloadURL)
+		if err != nil {
+			return nil, 0, err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		size := int64(-1)
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
+		}
+		return file, size, nil
+	}
+
+	resp, err := http.Get(downloadURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err := fmt.Errorf("failed to download: HTTP status %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusNotFound {
+			err = withCode(codeVersionNotFound, err)
+		}
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// fileURLPath returns the local path of a file:// URL
+func fileURLPath(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %w", fileURL, err)
+	}
+	path := filepath.FromSlash(u.Path)
+	// file:///C:/dir parses to /C:/dir
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, `\`)
+	}
+	return path, nil
+}
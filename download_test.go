@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setDownloadConfig overrides the download template and mirrors for a test
+func setDownloadConfig(t *testing.T, template string, mirrors ...string) {
+	originalTemplate := downloadURLTemplate
+	originalMirrors := downloadMirrors
+	originalIndexAsset := indexAsset
+	downloadURLTemplate = template
+	downloadMirrors = mirrors
+	indexAsset = func(version, osName, archName string) *Asset {
+		return nil
+	}
+	t.Cleanup(func() {
+		downloadURLTemplate = originalTemplate
+		downloadMirrors = originalMirrors
+		indexAsset = originalIndexAsset
+	})
+}
+
+func TestExpandURLTemplate(t *testing.T) {
+	template := "https://mirror.example.com/ddn/{version}/cli-ddn-{os}-{arch}{ext}"
+	if got := expandURLTemplate(template, "v3.0.1", "linux", "amd64"); got != "https://mirror.example.com/ddn/v3.0.1/cli-ddn-linux-amd64" {
+		t.Fatalf("Unexpected linux URL: %s", got)
+	}
+	if got := expandURLTemplate(template, "v3.0.1", "windows", "amd64"); got != "https://mirror.example.com/ddn/v3.0.1/cli-ddn-windows-amd64.exe" {
+		t.Fatalf("Unexpected windows URL: %s", got)
+	}
+
+	// The default template keeps the CDN layout
+	if got := expandURLTemplate(defaultDownloadURLTemplate, "v3.0.1", "darwin", "arm64"); got != "https://graphql-engine-cdn.hasura.io/ddn/cli/v4/v3.0.1/cli-ddn-darwin-arm64" {
+		t.Fatalf("Unexpected default URL: %s", got)
+	}
+}
+
+func TestDownloadCandidates(t *testing.T) {
+	setDownloadConfig(t, "https://cdn.example.com/{version}/ddn-{os}-{arch}",
+		"https://mirror-a.example.com/{version}/ddn-{os}-{arch}",
+		"https://cdn.example.com/{version}/ddn-{os}-{arch}")
+
+	// Mirrors follow the template, without duplicates
+	expected := []string{
+		"https://cdn.example.com/v3.0.1/ddn-linux-amd64",
+		"https://mirror-a.example.com/v3.0.1/ddn-linux-amd64",
+	}
+	if got := downloadCandidates("v3.0.1", "linux", "amd64", nil); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+
+	// The asset URL from the release index is preferred
+	indexAsset = func(version, osName, archName string) *Asset {
+		return &Asset{Name: assetName(osName, archName), BrowserDownloadURL: "https://github.com/acme/ddn/releases/download/v3.0.1/cli-ddn-linux-amd64"}
+	}
+	got := downloadCandidates("v3.0.1", "linux", "amd64", nil)
+	if len(got) != 3 || got[0] != "https://github.com/acme/ddn/releases/download/v3.0.1/cli-ddn-linux-amd64" {
+		t.Fatalf("Expected the index asset URL first, got %v", got)
+	}
+
+	// A lock file's URL replaces both, the mirrors stay as fallbacks
+	locked := &LockedBinary{URL: "https://locked.example.com/ddn", SHA256: "abc"}
+	got = downloadCandidates("v3.0.1", "linux", "amd64", locked)
+	if len(got) != 3 || got[0] != locked.URL || got[1] != "https://mirror-a.example.com/v3.0.1/ddn-linux-amd64" {
+		t.Fatalf("Expected the locked URL followed by the mirrors, got %v", got)
+	}
+}
+
+func TestDownloadFallsBackToMirrors(t *testing.T) {
+	content := []byte("#!/bin/sh\necho ddn\n")
+	sum := sha256.Sum256(content)
+	locked := &LockedBinary{SHA256: hex.EncodeToString(sum[:])}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer broken.Close()
+	tampered := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\necho evil\n"))
+	}))
+	defer tampered.Close()
+
+	// The last mirror is a local directory
+	mirrorDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mirrorDir, "v3.0.1"), 0755); err != nil {
+		t.Fatalf("Failed to create mirror: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mirrorDir, "v3.0.1", "ddn"), content, 0755); err != nil {
+		t.Fatalf("Failed to write mirror binary: %v", err)
+	}
+	fileMirror := "file:///" + strings.TrimPrefix(filepath.ToSlash(mirrorDir), "/") + "/{version}/ddn"
+
+	candidates := []string{
+		broken.URL + "/ddn",
+		tampered.URL + "/ddn",
+		expandURLTemplate(fileMirror, "v3.0.1", "linux", "amd64"),
+	}
+	binPath := filepath.Join(t.TempDir(), binName)
+	used, err := downloadFromCandidates("v3.0.1", candidates, binPath, locked)
+	if err != nil {
+		t.Fatalf("Expected the local mirror to be used, got %v", err)
+	}
+	if used != candidates[2] {
+		t.Fatalf("Expected %s to be used, got %s", candidates[2], used)
+	}
+	data, err := os.ReadFile(binPath)
+	if err != nil || string(data) != string(content) {
+		t.Fatalf("Unexpected downloaded binary: %q (%v)", data, err)
+	}
+
+	// When every URL fails, the error covers all of them
+	if _, err := downloadFromCandidates("v3.0.1", candidates[:2], binPath, locked); err == nil {
+		t.Fatal("Expected an error when every URL fails")
+	}
+}
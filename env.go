@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Shells supported by the env command
+const (
+	shellBash       = "bash"
+	shellZsh        = "zsh"
+	shellFish       = "fish"
+	shellPowerShell = "powershell"
+)
+
+// detectShell guesses the user's shell from the environment
+func detectShell() string {
+	if runtime.GOOS == "windows" {
+		return shellPowerShell
+	}
+
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "fish":
+		return shellFish
+	case "zsh":
+		return shellZsh
+	default:
+		return shellBash
+	}
+}
+
+// normalizeShell validates a --shell value, defaulting to the detected shell
+func normalizeShell(shell string) (string, error) {
+	switch strings.ToLower(shell) {
+	case "":
+		return detectShell(), nil
+	case shellBash, "sh":
+		return shellBash, nil
+	case shellZsh:
+		return shellZsh, nil
+	case shellFish:
+		return shellFish, nil
+	case shellPowerShell, "pwsh":
+		return shellPowerShell, nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q (expected bash, zsh, fish or powershell)", shell)
+	}
+}
+
+// printVersionEnv prints shell code that puts version first on PATH for the
+// current shell only. The active symlink is never touched.
+func printVersionEnv(spec, shell string) error {
+	shell, err := normalizeShell(shell)
+	if err != nil {
+		return err
+	}
+
+	// Progress output must not end up in the evaluated script
+	var binPath string
+	err = withStdoutToStderr(func() error {
+		var err error
+		binPath, err = ensureVersionInstalled(spec)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	versionDir := filepath.Dir(binPath)
+	version := filepath.Base(versionDir)
+
+	pathDirs, err := pathWithoutStore()
+	if err != nil {
+		return err
+	}
+	pathDirs = append([]string{versionDir}, pathDirs...)
+
+	fmt.Print(formatEnv(shell, pathDirs, version))
+	return nil
+}
+
+// pathWithoutStore returns PATH without any directories from the install
+// directory, so repeated evals replace the version instead of stacking up
+func pathWithoutStore() ([]string, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(installPath, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			debugLog("Dropping %s from PATH", dir)
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// formatEnv renders the PATH and DDN_CLI_VERSION assignments for shell
+func formatEnv(shell string, pathDirs []string, version string) string {
+	switch shell {
+	case shellFish:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("set -gx %s %s;\n", versionEnvVar, quoteFish(version))
+	case shellPowerShell:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("$env:%s = %s\n", versionEnvVar, quotePowerShell(version))
+	default:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("export %s=%s\n", versionEnvVar, quotePosix(version))
+	}
+}
+
+// formatUnsetEnv renders the PATH assignment and removes DDN_CLI_VERSION
+func formatUnsetEnv(shell string, pathDirs []string) string {
+	switch shell {
+	case shellFish:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("set -e %s;\n", versionEnvVar)
+	case shellPowerShell:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue\n", versionEnvVar)
+	default:
+		return formatPath(shell, pathDirs) + fmt.Sprintf("unset %s\n", versionEnvVar)
+	}
+}
+
+// formatPath renders a PATH assignment for shell
+func formatPath(shell string, pathDirs []string) string {
+	switch shell {
+	case shellFish:
+		var b strings.Builder
+		b.WriteString("set -gx PATH")
+		for _, dir := range pathDirs {
+			b.WriteString(" " + quoteFish(dir))
+		}
+		b.WriteString(";\n")
+		return b.String()
+	case shellPowerShell:
+		return fmt.Sprintf("$env:PATH = %s\n", quotePowerShell(strings.Join(pathDirs, string(os.PathListSeparator))))
+	default:
+		return fmt.Sprintf("export PATH=%s\n", quotePosix(strings.Join(pathDirs, string(os.PathListSeparator))))
+	}
+}
+
+// printUnsetEnv prints code that drops session versions from PATH and clears DDN_CLI_VERSION
+func printUnsetEnv(shell string) error {
+	shell, err := normalizeShell(shell)
+	if err != nil {
+		return err
+	}
+
+	pathDirs, err := pathWithoutStore()
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(formatUnsetEnv(shell, pathDirs))
+	return nil
+}
+
+func quotePosix(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func quoteFish(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func quotePowerShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
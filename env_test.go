@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathWithoutStore(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	sep := string(os.PathListSeparator)
+	oldVersionDir := filepath.Join(tempDir, "v2.9.0")
+	t.Setenv("PATH", strings.Join([]string{oldVersionDir, "/usr/local/bin", "/usr/bin"}, sep))
+
+	dirs, err := pathWithoutStore()
+	if err != nil {
+		t.Fatalf("Failed to compute PATH: %v", err)
+	}
+	if strings.Join(dirs, sep) != strings.Join([]string{"/usr/local/bin", "/usr/bin"}, sep) {
+		t.Fatalf("Expected store directories to be dropped, got %v", dirs)
+	}
+}
+
+func TestFormatEnv(t *testing.T) {
+	dirs := []string{"/store/v3.0.1", "/it's/bin"}
+	sep := string(os.PathListSeparator)
+
+	bash := formatEnv(shellBash, dirs, "v3.0.1")
+	expected := "export PATH='/store/v3.0.1" + sep + "/it'\\''s/bin'\nexport DDN_CLI_VERSION='v3.0.1'\n"
+	if bash != expected {
+		t.Fatalf("Unexpected bash output:\n%s", bash)
+	}
+
+	fish := formatEnv(shellFish, dirs, "v3.0.1")
+	if !strings.HasPrefix(fish, `set -gx PATH '/store/v3.0.1' '/it\'s/bin';`) {
+		t.Fatalf("Unexpected fish output:\n%s", fish)
+	}
+
+	pwsh := formatEnv(shellPowerShell, dirs, "v3.0.1")
+	if !strings.Contains(pwsh, "$env:PATH = '/store/v3.0.1"+sep+"/it''s/bin'") {
+		t.Fatalf("Unexpected PowerShell output:\n%s", pwsh)
+	}
+
+	if _, err := normalizeShell("tcsh"); err == nil {
+		t.Fatal("Expected an error for an unsupported shell")
+	}
+}
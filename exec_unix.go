@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// execBinary replaces the current process with binPath so signals, stdio and
+// the exit code belong to the DDN CLI directly. It only returns on failure.
+func execBinary(binPath string, args []string) (int, error) {
+	argv := append([]string{binPath}, args...)
+	if err := syscall.Exec(binPath, argv, os.Environ()); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
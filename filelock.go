@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// storeLockName guards the install directory as a whole
+	storeLockName = ".lock"
+	// versionLocksDir holds one lock file per version
+	versionLocksDir = ".locks"
+)
+
+// lockTimeout is how long to wait for another ddnswitch process to release a lock
+var lockTimeout = 5 * time.Minute
+
+// fileLock is an advisory lock held on an open file
+type fileLock struct {
+	file *os.File
+	path string
+}
+
+// acquireLock takes an advisory lock on path, waiting up to timeout for other
+// processes to release it. Shared locks can be held by many processes at once;
+// an exclusive holder records its PID so waiters can say who they wait for.
+// The second return value reports whether the lock was contended.
+func acquireLock(path string, exclusive bool, timeout time.Duration) (*fileLock, bool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waited := false
+	for {
+		ok, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close()
+			return nil, waited, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+
+		holder := lockHolder(path)
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, waited, withCode(codeLockTimeout, fmt.Errorf("timed out after %v waiting for lock %s held by %s", timeout, path, holder))
+		}
+		if !waited {
+			fmt.Fprintf(os.Stderr, "Waiting for another ddnswitch process (%s) to release %s...\n", holder, path)
+			waited = true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if exclusive {
+		file.Truncate(0)
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	debugLog("Acquired %s lock %s", lockKind(exclusive), path)
+	return &fileLock{file: file, path: path}, waited, nil
+}
+
+// Release unlocks and closes the lock file
+func (l *fileLock) Release() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.file)
+	l.file.Close()
+	debugLog("Released lock %s", l.path)
+}
+
+// lockHolder describes the process recorded in a lock file
+func lockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "unknown process"
+	}
+	pid := strings.TrimSpace(string(data))
+	if pid == "" {
+		return "another process"
+	}
+	return "PID " + pid
+}
+
+func lockKind(exclusive bool) string {
+	if exclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// lockVersion takes a shared lock on the store and an exclusive lock on one
+// version, so installs of the same version serialize while different
+// versions proceed in parallel
+func lockVersion(version string) (func(), bool, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return nil, false, err
+	}
+
+	storeLock, _, err := acquireLock(filepath.Join(installPath, storeLockName), false, lockTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	versionLock, waited, err := acquireLock(filepath.Join(installPath, versionLocksDir, version+".lock"), true, lockTimeout)
+	if err != nil {
+		storeLock.Release()
+		return nil, false, err
+	}
+
+	release := func() {
+		versionLock.Release()
+		storeLock.Release()
+	}
+	return release, waited, nil
+}
+
+// lockStore takes an exclusive lock on the whole install directory at
+// installPath, waiting for installs into it to finish
+func lockStore(installPath string) (func(), error) {
+	storeLock, _, err := acquireLock(filepath.Join(installPath, storeLockName), true, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return storeLock.Release, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockTimeoutNamesHolder(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "v3.0.1.lock")
+
+	held, _, err := acquireLock(lockPath, true, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer held.Release()
+
+	_, _, err = acquireLock(lockPath, true, 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("Expected a timeout while the lock is held")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("PID %d", os.Getpid())) {
+		t.Fatalf("Timeout error does not name the holding PID: %v", err)
+	}
+}
+
+func TestAcquireLockShared(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+
+	first, _, err := acquireLock(lockPath, false, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to acquire shared lock: %v", err)
+	}
+	second, _, err := acquireLock(lockPath, false, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Shared locks should not block each other: %v", err)
+	}
+
+	// An exclusive lock has to wait for both shared holders
+	if _, _, err := acquireLock(lockPath, true, 200*time.Millisecond); err == nil {
+		t.Fatal("Exclusive lock was granted while shared locks are held")
+	}
+
+	first.Release()
+	second.Release()
+
+	exclusive, _, err := acquireLock(lockPath, true, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to acquire exclusive lock after release: %v", err)
+	}
+	exclusive.Release()
+}
+
+func TestConcurrentInstallsOfSameVersionReuseResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	originalDownloadBinary := downloadBinary
+	originalLookupChecksum := lookupChecksum
+	originalIndexAsset := indexAsset
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		downloadBinary = originalDownloadBinary
+		lookupChecksum = originalLookupChecksum
+		indexAsset = originalIndexAsset
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+	lookupChecksum = func(version, downloadURL, osName, archName string) (string, error) {
+		return strings.Repeat("a", 64), nil
+	}
+	indexAsset = func(version, osName, archName string) *Asset {
+		return nil
+	}
+
+	var downloads int32
+	downloadBinary = func(url, destPath, expectedSHA256 string) error {
+		atomic.AddInt32(&downloads, 1)
+		// Keep the lock held long enough for the other install to queue up
+		time.Sleep(300 * time.Millisecond)
+		version := filepath.Base(filepath.Dir(url))
+		mockBinaryContent := "#!/bin/sh\necho \"DDN CLI Version: " + version + "\"\n"
+		return os.WriteFile(destPath, []byte(mockBinaryContent), 0755)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = installVersion("v2.28.0")
+		}(i)
+		time.Sleep(50 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Install failed: %v", err)
+		}
+	}
+	if downloads != 1 {
+		t.Fatalf("Expected the second install to reuse the first, got %d downloads", downloads)
+	}
+}
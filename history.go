@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// maxHistory is how many switches state.json keeps
+const maxHistory = 50
+
+// previousArg switches back to the previous version, like `cd -`
+const previousArg = "-"
+
+// HistoryEntry is one switch in the history
+type HistoryEntry struct {
+	Version    string    `json:"version" yaml:"version"`
+	Dir        string    `json:"dir,omitempty" yaml:"dir,omitempty"`
+	SwitchedAt time.Time `json:"switched_at" yaml:"switched_at"`
+}
+
+// appendHistory adds a switch to version to the history, dropping the oldest
+// entries past maxHistory
+func appendHistory(state *State, version string, at time.Time) {
+	dir, err := os.Getwd()
+	if err != nil {
+		debugLog("Failed to get the working directory: %v", err)
+	}
+	state.History = append(state.History, HistoryEntry{Version: version, Dir: dir, SwitchedAt: at})
+	if len(state.History) > maxHistory {
+		state.History = state.History[len(state.History)-maxHistory:]
+	}
+}
+
+// recordDefaultSwitch adds a switch of the shim's default version to the history
+func recordDefaultSwitch(version string) error {
+	return updateState(func(state *State) {
+		appendHistory(state, version, time.Now().UTC())
+	})
+}
+
+// switchHistory returns up to limit switches, most recent first. A limit of
+// zero or less returns all of them.
+func switchHistory(limit int) []HistoryEntry {
+	history := readState().History
+	entries := []HistoryEntry{}
+	for i := len(history) - 1; i >= 0; i-- {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		entries = append(entries, history[i])
+	}
+	return entries
+}
+
+// previousVersion returns the most recently switched to version other than
+// the active one. With the shim, switches change the global default, which a
+// pin file may be overriding here, so that is what is compared.
+func previousVersion() (string, error) {
+	active := activeVersion()
+	if symlinkPath, err := getSymlinkPath(); err == nil && isShimLink(symlinkPath) {
+		defaultVersion, err := readDefaultVersion()
+		if err != nil {
+			return "", err
+		}
+		active = defaultVersion
+	}
+	for _, entry := range switchHistory(0) {
+		if entry.Version != active {
+			return entry.Version, nil
+		}
+	}
+	return "", withCode(codeVersionNotFound, fmt.Errorf("no previous version to switch back to"))
+}
+
+// switchToPrevious switches back to the version active before the current one
+func switchToPrevious() error {
+	version, err := previousVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Switching back to DDN CLI version %s...\n", version)
+	return switchToVersion(version)
+}
+
+// printHistory prints recent switches for `history`
+func printHistory(entries []HistoryEntry) {
+	if len(entries) == 0 {
+		fmt.Println("No switches recorded yet")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSWITCHED\tDIRECTORY")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Version, entry.SwitchedAt.Local().Format("2006-01-02 15:04:05"), entry.Dir)
+	}
+	w.Flush()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSwitchToPreviousToggles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+	writeVersionScripts(t, installDir, "v3.0.1", "v3.0.2")
+
+	// Nothing to go back to before the first switch
+	if err := switchToPrevious(); err == nil || errorCode(err) != codeVersionNotFound {
+		t.Fatalf("Expected a version_not_found error without history, got %v", err)
+	}
+
+	if err := switchToVersion("v3.0.1"); err != nil {
+		t.Fatalf("Failed to switch: %v", err)
+	}
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project directory: %v", err)
+	}
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	if err := switchToVersion("v3.0.2"); err != nil {
+		t.Fatalf("Failed to switch: %v", err)
+	}
+
+	// - goes back and forth between the last two versions
+	for _, expected := range []string{"v3.0.1", "v3.0.2", "v3.0.1"} {
+		if err := switchToPrevious(); err != nil {
+			t.Fatalf("Failed to switch back: %v", err)
+		}
+		if active := activeVersion(); active != expected {
+			t.Fatalf("Expected %s after switching back, got %s", expected, active)
+		}
+	}
+
+	history := switchHistory(0)
+	if len(history) != 5 {
+		t.Fatalf("Expected 5 switches in the history, got %d", len(history))
+	}
+	if history[0].Version != "v3.0.1" || history[0].Dir != projectDir {
+		t.Fatalf("Expected the latest switch first, from %s, got %+v", projectDir, history[0])
+	}
+	if history[4].Dir == projectDir {
+		t.Fatal("Expected the first switch to record the directory it was run from")
+	}
+	if limited := switchHistory(2); len(limited) != 2 || limited[1].Version != "v3.0.2" {
+		t.Fatalf("Expected the 2 latest switches, got %+v", limited)
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	var state State
+	start := time.Now()
+	for i := 0; i < maxHistory+5; i++ {
+		appendHistory(&state, "v3.0.1", start.Add(time.Duration(i)*time.Second))
+	}
+	if len(state.History) != maxHistory {
+		t.Fatalf("Expected %d entries, got %d", maxHistory, len(state.History))
+	}
+	if !state.History[0].SwitchedAt.Equal(start.Add(5 * time.Second)) {
+		t.Fatal("Expected the oldest entries to be dropped")
+	}
+}
+
+func TestSwitchToPreviousWithShimTogglesDefault(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	chdirForTest(t, tempDir)
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+	writeVersionScripts(t, installDir, "v3.0.1", "v3.0.2")
+
+	// The shim is a link to ddnswitch itself
+	self, err := selfExecutable()
+	if err != nil {
+		t.Fatalf("Failed to find the test binary: %v", err)
+	}
+	if err := createSymlinkAt(symlinkPath, self); err != nil {
+		t.Fatalf("Failed to create shim link: %v", err)
+	}
+
+	for _, version := range []string{"v3.0.1", "v3.0.2"} {
+		if err := switchToVersion(version); err != nil {
+			t.Fatalf("Failed to switch to %s: %v", version, err)
+		}
+	}
+
+	// A pin on the older version makes it active here, but - is about the default
+	if err := os.WriteFile(filepath.Join(tempDir, pinFileName), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+	if err := switchToPrevious(); err != nil {
+		t.Fatalf("Failed to switch back: %v", err)
+	}
+	if defaultVersion, _ := readDefaultVersion(); defaultVersion != "v3.0.1" {
+		t.Fatalf("Expected the default to go back to v3.0.1, got %s", defaultVersion)
+	}
+}
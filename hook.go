@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// posixHookBody finds the nearest pin file with shell builtins only and calls
+// ddnswitch when the pin file or its contents change. The last directory is
+// cached so prompts and cd within the same directory cost nothing.
+const posixHookBody = `_ddnswitch_hook() {
+  [[ "$PWD" == "${_DDNSWITCH_LAST_PWD-}" ]] && return
+  _DDNSWITCH_LAST_PWD="$PWD"
+
+  local dir="$PWD" pin="" spec=""
+  while true; do
+    if [[ -f "$dir/%[1]s" ]]; then
+      pin="$dir/%[1]s"
+      break
+    fi
+    [[ -z "$dir" || "$dir" == "/" ]] && break
+    dir="${dir%%/*}"
+    [[ -z "$dir" ]] && dir="/"
+  done
+  [[ -n "$pin" ]] && read -r spec < "$pin"
+
+  local key="$pin:$spec"
+  [[ "$key" == "${_DDNSWITCH_LAST_PIN-}" ]] && return
+  _DDNSWITCH_LAST_PIN="$key"
+
+  local out
+  out="$(command ddnswitch env --pin --shell %[2]s)" || _DDNSWITCH_LAST_PIN=""
+  eval "$out"
+}
+`
+
+const bashHookRegister = `if [[ ";${PROMPT_COMMAND[*]:-};" != *";_ddnswitch_hook;"* ]]; then
+  PROMPT_COMMAND="_ddnswitch_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+_ddnswitch_hook
+`
+
+const zshHookRegister = `autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _ddnswitch_hook
+_ddnswitch_hook
+`
+
+const fishHook = `function _ddnswitch_hook --on-variable PWD
+  test "$PWD" = "$_ddnswitch_last_pwd"; and return
+  set -g _ddnswitch_last_pwd $PWD
+
+  set -l dir $PWD
+  set -l pin ""
+  set -l spec ""
+  while true
+    if test -f "$dir/%[1]s"
+      set pin "$dir/%[1]s"
+      break
+    end
+    if test -z "$dir" -o "$dir" = "/"
+      break
+    end
+    set dir (string replace -r '/[^/]*$' '' -- $dir)
+    test -z "$dir"; and set dir /
+  end
+  test -n "$pin"; and read -l spec < $pin
+
+  set -l key "$pin:$spec"
+  test "$key" = "$_ddnswitch_last_pin"; and return
+  set -g _ddnswitch_last_pin $key
+
+  set -l out (command ddnswitch env --pin --shell fish); or set -g _ddnswitch_last_pin ""
+  printf '%%s\n' $out | source
+end
+_ddnswitch_hook
+`
+
+// printHook prints the auto-switch hook for shell
+func printHook(shell string) error {
+	switch shell {
+	case shellBash:
+		fmt.Printf(posixHookBody, pinFileName, shellBash)
+		fmt.Print(bashHookRegister)
+	case shellZsh:
+		fmt.Printf(posixHookBody, pinFileName, shellZsh)
+		fmt.Print(zshHookRegister)
+	case shellFish:
+		fmt.Printf(fishHook, pinFileName)
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+// printPinnedEnv prints env code for the version pinned for the current
+// directory, or code that clears any session version when there is no pin.
+// It only looks at installed versions and never downloads, so it is cheap
+// enough to run from a shell hook.
+func printPinnedEnv(shell string) error {
+	shell, err := normalizeShell(shell)
+	if err != nil {
+		return err
+	}
+
+	spec, pinPath, err := resolvePinnedVersion()
+	if err != nil {
+		return err
+	}
+	if spec == "" {
+		return printUnsetEnv(shell)
+	}
+
+	version, err := resolveInstalledVersion(spec)
+	if err != nil {
+		return fmt.Errorf("%w (pinned by %s); run `ddnswitch install %q`", err, pinPath, spec)
+	}
+
+	binPath, err := versionBinPath(version)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		return fmt.Errorf("DDN CLI %s pinned by %s is not installed; run `ddnswitch install %s`", version, pinPath, version)
+	}
+	if err := checkLockedBinary(version, binPath); err != nil {
+		return err
+	}
+
+	pathDirs, err := pathWithoutStore()
+	if err != nil {
+		return err
+	}
+	pathDirs = append([]string{filepath.Dir(binPath)}, pathDirs...)
+
+	fmt.Fprintf(os.Stderr, "ddnswitch: using DDN CLI %s (pinned by %s)\n", version, pinPath)
+	fmt.Print(formatEnv(shell, pathDirs, version))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	fnErr := fn()
+	os.Stdout = stdout
+	w.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return buf.String(), fnErr
+}
+
+func TestPrintHookIsValidShell(t *testing.T) {
+	for _, shell := range []string{shellBash, shellZsh} {
+		out, err := captureStdout(t, func() error {
+			return printHook(shell)
+		})
+		if err != nil {
+			t.Fatalf("Failed to print %s hook: %v", shell, err)
+		}
+		if !strings.Contains(out, "ddnswitch env --pin --shell "+shell) {
+			t.Fatalf("%s hook does not call ddnswitch env --pin:\n%s", shell, out)
+		}
+		if !strings.Contains(out, pinFileName) {
+			t.Fatalf("%s hook does not look for %s:\n%s", shell, pinFileName, out)
+		}
+
+		// Syntax check with the real shell when it is available
+		shellPath, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(shellPath, "-n")
+		cmd.Stdin = strings.NewReader(out)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s hook has a syntax error: %v\n%s", shell, err, output)
+		}
+	}
+
+	if err := printHook("tcsh"); err == nil {
+		t.Fatal("Expected an error for an unsupported shell")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Which versions `list` shows
+const (
+	listCombined  = "combined"
+	listInstalled = "installed"
+	listRemote    = "remote"
+)
+
+// listScope picks the scope of `list` from --installed and --remote
+func listScope(installedOnly, remoteOnly bool) (string, error) {
+	switch {
+	case installedOnly && remoteOnly:
+		return "", withCode(codeInvalidArgument, fmt.Errorf("--installed and --remote can't be combined"))
+	case installedOnly:
+		return listInstalled, nil
+	case remoteOnly:
+		return listRemote, nil
+	}
+	return listCombined, nil
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// remoteRecord builds the record of a release from the index
+func remoteRecord(release Release, active string) VersionRecord {
+	record := versionRecord(release.TagName, release.PreRelease, active)
+	if release.localOnly {
+		// Offline without an index nothing is known to be downloadable
+		record.Remote = boolPtr(false)
+		record.Installable = boolPtr(false)
+		return record
+	}
+	record.Remote = boolPtr(true)
+	record.Installable = boolPtr(releaseInstallable(release, runtime.GOOS, runtime.GOARCH))
+	return record
+}
+
+// indexReleases returns every release in the index by tag, including the
+// pre-releases fetchAvailableVersions leaves out without --pre
+func indexReleases() (map[string]Release, error) {
+	body, err := loadReleaseIndex()
+	if err != nil {
+		return nil, err
+	}
+	var releases []Release
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, fmt.Errorf("failed to decode releases: %w", err)
+	}
+	byTag := map[string]Release{}
+	for _, release := range releases {
+		if !release.Draft {
+			byTag[release.TagName] = release
+		}
+	}
+	return byTag, nil
+}
+
+// listVersionRecords returns the versions in scope, newest first. The active
+// version is read once from the managed link rather than by running every
+// release.
+func listVersionRecords(scope string) ([]VersionRecord, error) {
+	if scope == listInstalled {
+		return installedVersionRecords()
+	}
+
+	releases, err := fetchAvailableVersions()
+	if err != nil {
+		return nil, err
+	}
+	active := activeVersion()
+
+	records := []VersionRecord{}
+	inIndex := map[string]bool{}
+	for _, release := range releases {
+		inIndex[release.TagName] = true
+		records = append(records, remoteRecord(release, active))
+	}
+	if scope == listRemote {
+		return records, nil
+	}
+
+	// Installed versions the index doesn't list (anymore) still belong in the combined view
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return nil, err
+	}
+	var unfiltered map[string]Release
+	for _, tag := range installed {
+		if inIndex[tag] {
+			continue
+		}
+		// Without --pre an installed pre-release may only be filtered out
+		if !includePrerelease && isPrereleaseTag(tag) {
+			if unfiltered == nil {
+				if unfiltered, err = indexReleases(); err != nil {
+					debugLog("Release index unavailable: %v", err)
+					unfiltered = map[string]Release{}
+				}
+			}
+			if release, ok := unfiltered[tag]; ok {
+				records = append(records, remoteRecord(release, active))
+				continue
+			}
+		}
+		record := versionRecord(tag, isPrereleaseTag(tag), active)
+		record.Remote = boolPtr(false)
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// sortRecords orders records newest first, like the release index
+func sortRecords(records []VersionRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		vi, err1 := semver.NewVersion(strings.TrimPrefix(records[i].Tag, "v"))
+		vj, err2 := semver.NewVersion(strings.TrimPrefix(records[j].Tag, "v"))
+		if err1 != nil || err2 != nil {
+			return records[i].Tag > records[j].Tag
+		}
+		return vi.GreaterThan(vj)
+	})
+}
+
+// listVersions prints the versions in scope
+func listVersions(scope string) error {
+	if scope != listInstalled {
+		fmt.Println("Fetching available DDN CLI versions...")
+	}
+
+	records, err := listVersionRecords(scope)
+	if err != nil {
+		return err
+	}
+
+	switch scope {
+	case listInstalled:
+		if len(records) == 0 {
+			fmt.Println("No DDN CLI versions installed")
+			return nil
+		}
+		fmt.Println("Installed DDN CLI versions:")
+	default:
+		fmt.Println("\nAvailable DDN CLI versions:")
+	}
+
+	for i, record := range records {
+		fmt.Printf("%2d. %s%s\n", i+1, record.Tag, recordMarkers(record, scope))
+	}
+	return nil
+}
+
+// recordMarkers describes a record in the list view
+func recordMarkers(record VersionRecord, scope string) string {
+	markers := ""
+	if record.Prerelease {
+		markers += " [pre-release]"
+	}
+	if record.Installed && scope != listInstalled {
+		markers += " [installed]"
+	}
+	if record.Remote != nil && !*record.Remote && scope == listCombined {
+		markers += " [not in release index]"
+	}
+	if record.Installable != nil && !*record.Installable && !record.Installed {
+		markers += fmt.Sprintf(" [not available for %s/%s]", runtime.GOOS, runtime.GOARCH)
+	} else if offlineMode && !record.Installed {
+		// Offline, only installed versions can be switched to
+		markers += " [not installed]"
+	}
+	if record.Active {
+		markers += " (current)"
+	}
+	return markers
+}
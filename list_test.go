@@ -0,0 +1,174 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListVersionRecords(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+	setOfflineMode(t, false)
+
+	// v3.1.0 has no build for this platform, v2.8.0 is installed but no longer in the index
+	primeVersionCache(t, "v3.1.0", "v3.0.1", "v2.9.0")
+	versionCacheMux.Lock()
+	versionCache[0].Assets = []Asset{{Name: assetName("plan9", "mips")}}
+	versionCache[1].Assets = []Asset{{Name: assetName(runtime.GOOS, runtime.GOARCH)}}
+	versionCacheMux.Unlock()
+
+	installMockVersions(t, installDir, "v3.0.1", "v2.8.0")
+	activeBinary, _ := versionBinPath("v3.0.1")
+	if err := createSymlinkAt(symlinkPath, activeBinary); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	records, err := listVersionRecords(listCombined)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	var tags []string
+	for _, record := range records {
+		tags = append(tags, record.Tag)
+	}
+	if strings.Join(tags, " ") != "v3.1.0 v3.0.1 v2.9.0 v2.8.0" {
+		t.Fatalf("Expected the index and installed versions newest first, got %v", tags)
+	}
+
+	expectedMarkers := map[string]string{
+		"v3.1.0": " [not available for " + runtime.GOOS + "/" + runtime.GOARCH + "]",
+		"v3.0.1": " [installed] (current)",
+		"v2.9.0": "",
+		"v2.8.0": " [installed] [not in release index]",
+	}
+	for _, record := range records {
+		if got := recordMarkers(record, listCombined); got != expectedMarkers[record.Tag] {
+			t.Errorf("Expected markers %q for %s, got %q", expectedMarkers[record.Tag], record.Tag, got)
+		}
+	}
+
+	// --remote leaves out what the index doesn't list, --installed what isn't installed
+	remote, err := listVersionRecords(listRemote)
+	if err != nil || len(remote) != 3 {
+		t.Fatalf("Expected the 3 releases in the index, got %d (%v)", len(remote), err)
+	}
+	installed, err := listVersionRecords(listInstalled)
+	if err != nil || len(installed) != 2 || installed[0].Tag != "v3.0.1" || !installed[0].Active {
+		t.Fatalf("Expected v3.0.1 (active) and v2.8.0, got %+v (%v)", installed, err)
+	}
+	if installed[0].Remote != nil {
+		t.Fatal("Expected --installed records not to claim anything about the index")
+	}
+}
+
+func TestListScope(t *testing.T) {
+	if scope, err := listScope(true, false); err != nil || scope != listInstalled {
+		t.Fatalf("Expected the installed scope, got %s (%v)", scope, err)
+	}
+	if scope, err := listScope(false, false); err != nil || scope != listCombined {
+		t.Fatalf("Expected the combined scope, got %s (%v)", scope, err)
+	}
+	if _, err := listScope(true, true); errorCode(err) != codeInvalidArgument {
+		t.Fatalf("Expected --installed --remote to be an invalid argument, got %v", err)
+	}
+}
+
+func TestReleaseInstallable(t *testing.T) {
+	withAssets := Release{TagName: "v3.0.1", Assets: []Asset{
+		{Name: "cli-ddn-linux-amd64"},
+		{Name: "cli-ddn-windows-amd64.exe"},
+	}}
+	if !releaseInstallable(withAssets, "linux", "amd64") || !releaseInstallable(withAssets, "windows", "amd64") {
+		t.Fatal("Expected platforms with an asset to be installable")
+	}
+	if releaseInstallable(withAssets, "darwin", "arm64") {
+		t.Fatal("Expected a platform without an asset not to be installable")
+	}
+
+	// Without assets the download URL template decides, except where there are no builds at all
+	bare := Release{TagName: "v3.0.1"}
+	if !releaseInstallable(bare, "darwin", "arm64") || releaseInstallable(bare, "linux", "arm64") {
+		t.Fatal("Unexpected installability for a release without assets")
+	}
+}
+
+func TestListVersionRecordsFilteredAndLocalVersions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	originalIncludePrerelease := includePrerelease
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+		includePrerelease = originalIncludePrerelease
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	getSymlinkPath = func() (string, error) {
+		return filepath.Join(tempDir, "bin", binName), nil
+	}
+	t.Setenv(indexPublicKeyEnvVar, "")
+	setOfflineMode(t, false)
+	includePrerelease = false
+	primeVersionCache(t)
+	serveReleaseIndex(t, `[{"tag_name":"v3.1.0-rc1","prerelease":true},{"tag_name":"v3.0.1"}]`)
+	installMockVersions(t, installDir, "v3.1.0-rc1", "v2.8.0")
+
+	// The installed pre-release is in the index, just not shown without --pre
+	records, err := listVersionRecords(listCombined)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(records) != 3 || records[0].Tag != "v3.1.0-rc1" {
+		t.Fatalf("Expected v3.1.0-rc1 first, got %+v", records)
+	}
+	if got := recordMarkers(records[0], listCombined); got != " [pre-release] [installed]" {
+		t.Fatalf("Unexpected markers for the installed pre-release: %q", got)
+	}
+
+	// Offline without any index, installed versions are not claimed to be downloadable
+	releasesURL = "http://127.0.0.1:0/releases.json"
+	getCacheDir = func() (string, error) {
+		return t.TempDir(), nil
+	}
+	versionCacheMux.Lock()
+	versionCacheTime = time.Time{}
+	versionCacheMux.Unlock()
+	setOfflineMode(t, true)
+
+	records, err = listVersionRecords(listCombined)
+	if err != nil {
+		t.Fatalf("Failed to list versions offline: %v", err)
+	}
+	for _, record := range records {
+		if record.Remote == nil || *record.Remote || record.Installable == nil || *record.Installable {
+			t.Fatalf("Expected %s to be neither remote nor installable, got %+v", record.Tag, record)
+		}
+	}
+}
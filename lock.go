@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const lockFileName = "ddnswitch.lock"
+
+// lockPlatforms are the platforms recorded by `ddnswitch lock`
+var lockPlatforms = []string{
+	"linux/amd64",
+	"darwin/amd64",
+	"darwin/arm64",
+	"windows/amd64",
+}
+
+// LockFile pins a DDN CLI version together with the exact bytes expected on
+// every platform, so all developers and CI runners execute the same binary
+type LockFile struct {
+	Version    string                  `json:"version"`
+	Constraint string                  `json:"constraint,omitempty"`
+	Platforms  map[string]LockedBinary `json:"platforms"`
+}
+
+type LockedBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// currentPlatform returns the os/arch key used in lock files
+func currentPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+func readLockFile(path string) (*LockFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if lock.Version == "" {
+		return nil, fmt.Errorf("%s does not contain a version", path)
+	}
+	return &lock, nil
+}
+
+func writeLockFile(path string, lock *LockFile) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// findLockFile returns the nearest ddnswitch.lock at or above the current
+// directory, or nil if there is none
+var findLockFile = func() (*LockFile, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, "", err
+	}
+
+	path, err := findUpwards(cwd, lockFileName)
+	if err != nil || path == "" {
+		return nil, "", err
+	}
+
+	lock, err := readLockFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	debugLog("Found lock file %s for version %s", path, lock.Version)
+	return lock, path, nil
+}
+
+// lockedBinary returns the locked download for version on this platform, or
+// nil when no lock file covers version
+func lockedBinary(version string) (*LockedBinary, string, error) {
+	lock, path, err := findLockFile()
+	if err != nil || lock == nil {
+		return nil, "", err
+	}
+	if lock.Version != version {
+		debugLog("Lock file %s is for %s, not %s", path, lock.Version, version)
+		return nil, "", nil
+	}
+
+	locked, ok := lock.Platforms[currentPlatform()]
+	if !ok || locked.SHA256 == "" {
+		return nil, "", fmt.Errorf("%s has no checksum for %s; run `ddnswitch lock` to update it", path, currentPlatform())
+	}
+	return &locked, path, nil
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// verifyFileChecksum checks a file against an expected hex SHA-256
+func verifyFileChecksum(path, expected string) error {
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	if !strings.EqualFold(actual, expected) {
+		return withCode(codeChecksumMismatch, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", path, expected, actual))
+	}
+	return nil
+}
+
+// checkLockedBinary verifies an installed binary against the lock file
+// covering version, if any, before it is run without going through
+// prepareVersion (the shim and the shell hook)
+func checkLockedBinary(version, binPath string) error {
+	locked, lockPath, err := lockedBinary(version)
+	if err != nil || locked == nil {
+		return err
+	}
+	if err := verifyFileChecksum(binPath, locked.SHA256); err != nil {
+		return fmt.Errorf("%w (locked by %s); run `ddnswitch install %s` to reinstall it", err, lockPath, version)
+	}
+	return nil
+}
+
+// remoteSHA256 downloads url and returns the hex SHA-256 of its body without
+// writing it to disk. It accepts the same URLs as an install.
+var remoteSHA256 = func(url string) (string, error) {
+	body, size, err := openDownload(url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, &progressReader{reader: body, size: size}); err != nil {
+		return "", fmt.Errorf("failed to read binary data: %w", err)
+	}
+	fmt.Println()
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// createLockFile resolves spec (or the pinned version when spec is empty) and
+// writes a lock file with the URL and checksum of every supported platform
+func createLockFile(spec string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if spec == "" {
+		pinned, pinPath, err := readPinSpec()
+		if err != nil {
+			return err
+		}
+		if pinned == "" {
+			return fmt.Errorf("no version given and no %s found in the current directory or any parent", pinFileName)
+		}
+		spec = pinned
+		dir = filepath.Dir(pinPath)
+	}
+
+	version, err := resolveVersion(spec)
+	if err != nil {
+		return err
+	}
+
+	lock := &LockFile{
+		Version:   version,
+		Platforms: map[string]LockedBinary{},
+	}
+	if spec != version {
+		lock.Constraint = spec
+	}
+
+	for _, platform := range lockPlatforms {
+		parts := strings.SplitN(platform, "/", 2)
+		url := binaryDownloadURL(version, parts[0], parts[1])
+
+		fmt.Printf("Hashing %s binary for %s...\n", version, platform)
+		sum, err := remoteSHA256(url)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s binary: %w", platform, err)
+		}
+		debugLog("%s: %s %s", platform, url, sum)
+
+		// The lock becomes the trusted checksum, so it must agree with the published one
+		published, err := lookupChecksum(version, url, parts[0], parts[1])
+		if err != nil {
+			return fmt.Errorf("failed to look up the published checksum of the %s binary: %w", platform, err)
+		}
+		if published == "" {
+			fmt.Fprintf(os.Stderr, "Warning: no checksum published for the %s binary, locking it unverified\n", platform)
+		} else if !strings.EqualFold(sum, published) {
+			return withCode(codeChecksumMismatch, fmt.Errorf("checksum mismatch for the %s binary at %s: published %s, downloaded %s; refusing to lock it", platform, url, published, sum))
+		}
+
+		lock.Platforms[platform] = LockedBinary{URL: url, SHA256: sum}
+	}
+
+	path := filepath.Join(dir, lockFileName)
+	if err := writeLockFile(path, lock); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	fmt.Printf("Locked DDN CLI %s in %s\n", version, path)
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateLockFile(t *testing.T) {
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	originalRemoteSHA256 := remoteSHA256
+	originalIndexAsset := indexAsset
+	originalLookupChecksum := lookupChecksum
+	defer func() {
+		remoteSHA256 = originalRemoteSHA256
+		indexAsset = originalIndexAsset
+		lookupChecksum = originalLookupChecksum
+	}()
+	indexAsset = func(version, osName, archName string) *Asset {
+		return nil
+	}
+	lookupChecksum = func(version, downloadURL, osName, archName string) (string, error) {
+		return "abc123", nil
+	}
+	var hashedURLs []string
+	remoteSHA256 = func(url string) (string, error) {
+		hashedURLs = append(hashedURLs, url)
+		return "abc123", nil
+	}
+
+	if err := os.WriteFile(filepath.Join(projectDir, pinFileName), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+
+	if err := createLockFile(""); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+
+	lock, err := readLockFile(filepath.Join(projectDir, lockFileName))
+	if err != nil {
+		t.Fatalf("Failed to read lock file: %v", err)
+	}
+	if lock.Version != "v3.0.1" {
+		t.Fatalf("Expected locked version v3.0.1, got %s", lock.Version)
+	}
+	if len(lock.Platforms) != len(lockPlatforms) || len(hashedURLs) != len(lockPlatforms) {
+		t.Fatalf("Expected %d platforms, got %d", len(lockPlatforms), len(lock.Platforms))
+	}
+	darwin := lock.Platforms["darwin/arm64"]
+	if darwin.SHA256 != "abc123" || !strings.HasSuffix(darwin.URL, "/v3.0.1/cli-ddn-darwin-arm64") {
+		t.Fatalf("Unexpected darwin/arm64 entry: %+v", darwin)
+	}
+}
+
+func TestCreateLockFileFromFileURLs(t *testing.T) {
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	// Every platform's binary is in a local directory
+	mirrorDir := t.TempDir()
+	for _, platform := range lockPlatforms {
+		parts := strings.SplitN(platform, "/", 2)
+		name := expandURLTemplate("v3.0.1/cli-ddn-{os}-{arch}{ext}", "v3.0.1", parts[0], parts[1])
+		if err := os.MkdirAll(filepath.Join(mirrorDir, "v3.0.1"), 0755); err != nil {
+			t.Fatalf("Failed to create mirror: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(mirrorDir, filepath.FromSlash(name)), []byte(platform), 0755); err != nil {
+			t.Fatalf("Failed to write mirror binary: %v", err)
+		}
+	}
+	setDownloadConfig(t, "file:///"+strings.TrimPrefix(filepath.ToSlash(mirrorDir), "/")+"/{version}/cli-ddn-{os}-{arch}{ext}")
+
+	// A binary that doesn't match its published checksum is never locked
+	sum := sha256.Sum256([]byte("linux/amd64"))
+	checksumPath := filepath.Join(mirrorDir, "v3.0.1", "cli-ddn-linux-amd64.sha256")
+	if err := os.WriteFile(checksumPath, []byte(strings.Repeat("0", 64)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write checksum file: %v", err)
+	}
+	if err := createLockFile("v3.0.1"); err == nil || errorCode(err) != codeChecksumMismatch {
+		t.Fatalf("Expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, lockFileName)); !os.IsNotExist(err) {
+		t.Fatal("Lock file was written for a mismatching binary")
+	}
+
+	if err := os.WriteFile(checksumPath, []byte(hex.EncodeToString(sum[:])+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write checksum file: %v", err)
+	}
+	if err := createLockFile("v3.0.1"); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+
+	lock, err := readLockFile(filepath.Join(projectDir, lockFileName))
+	if err != nil {
+		t.Fatalf("Failed to read lock file: %v", err)
+	}
+	if linux := lock.Platforms["linux/amd64"]; linux.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("Unexpected linux/amd64 entry: %+v", linux)
+	}
+}
+
+func TestInstallVersionVerifiesLockFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	testVersion := "v2.28.0"
+	mockBinaryContent := "#!/bin/sh\necho \"DDN CLI Version: " + testVersion + "\"\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockBinaryContent))
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256([]byte(mockBinaryContent))
+	lock := &LockFile{
+		Version: testVersion,
+		Platforms: map[string]LockedBinary{
+			currentPlatform(): {URL: server.URL + "/ddn", SHA256: hex.EncodeToString(sum[:])},
+		},
+	}
+	lockPath := filepath.Join(projectDir, lockFileName)
+	if err := writeLockFile(lockPath, lock); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	// The locked URL is used and the binary matches the lock
+	if err := installVersion(testVersion); err != nil {
+		t.Fatalf("Failed to install locked version: %v", err)
+	}
+
+	// A binary that doesn't match the lock is rejected and the installed one is kept
+	lock.Platforms[currentPlatform()] = LockedBinary{URL: server.URL + "/ddn", SHA256: strings.Repeat("0", 64)}
+	if err := writeLockFile(lockPath, lock); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+	if err := installVersion(testVersion); err == nil {
+		t.Fatal("Expected an error for a checksum mismatch")
+	}
+	binPath := filepath.Join(tempDir, testVersion, binName)
+	content, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("Installed binary was removed: %v", err)
+	}
+	if string(content) != mockBinaryContent {
+		t.Fatal("Mismatching binary replaced the installed one")
+	}
+}
+
+func TestWaitedInstallVerifiesLockFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	testVersion := "v2.28.0"
+	lockedContent := "#!/bin/sh\n# locked\necho \"DDN CLI Version: " + testVersion + "\"\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lockedContent))
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256([]byte(lockedContent))
+	lock := &LockFile{
+		Version: testVersion,
+		Platforms: map[string]LockedBinary{
+			currentPlatform(): {URL: server.URL + "/ddn", SHA256: hex.EncodeToString(sum[:])},
+		},
+	}
+	if err := writeLockFile(filepath.Join(projectDir, lockFileName), lock); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	// Another process holds the version lock and leaves a binary that runs
+	// but doesn't match the lock file
+	held, _, err := acquireLock(filepath.Join(tempDir, versionLocksDir, testVersion+".lock"), true, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	binPath := filepath.Join(tempDir, testVersion, binName)
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		t.Fatalf("Failed to create version directory: %v", err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\necho \"DDN CLI Version: "+testVersion+"\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write binary: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- installVersion(testVersion)
+	}()
+	time.Sleep(300 * time.Millisecond)
+	held.Release()
+	if err := <-done; err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	content, err := os.ReadFile(binPath)
+	if err != nil || string(content) != lockedContent {
+		t.Fatalf("Expected the unverified binary to be replaced by the locked one, got %q (%v)", content, err)
+	}
+}
+
+func TestShimAndHookVerifyLockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	projectDir := t.TempDir()
+	chdirForTest(t, projectDir)
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	// Installed before the lock file existed
+	installMockVersions(t, tempDir, "v3.0.1")
+	if err := os.WriteFile(filepath.Join(projectDir, pinFileName), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+	lock := &LockFile{
+		Version: "v3.0.1",
+		Platforms: map[string]LockedBinary{
+			currentPlatform(): {URL: "https://example.com/ddn", SHA256: strings.Repeat("0", 64)},
+		},
+	}
+	lockPath := filepath.Join(projectDir, lockFileName)
+	if err := writeLockFile(lockPath, lock); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	// Neither the hook nor the shim hands out a binary that doesn't match
+	if _, err := captureStdout(t, func() error { return printPinnedEnv(shellBash) }); err == nil || errorCode(err) != codeChecksumMismatch {
+		t.Fatalf("Expected a checksum mismatch from the hook, got %v", err)
+	}
+	if code := runShim([]string{"version"}); code != 1 {
+		t.Fatalf("Expected the shim to refuse the binary, got exit code %d", code)
+	}
+
+	binPath, _ := versionBinPath("v3.0.1")
+	sum, err := fileSHA256(binPath)
+	if err != nil {
+		t.Fatalf("Failed to hash binary: %v", err)
+	}
+	lock.Platforms[currentPlatform()] = LockedBinary{URL: "https://example.com/ddn", SHA256: sum}
+	if err := writeLockFile(lockPath, lock); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+	output, err := captureStdout(t, func() error { return printPinnedEnv(shellBash) })
+	if err != nil || !strings.Contains(output, filepath.Join(tempDir, "v3.0.1")) {
+		t.Fatalf("Expected the matching binary on PATH, got %q (%v)", output, err)
+	}
+}
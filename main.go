@@ -30,18 +30,49 @@ func debugLog(format string, args ...interface{}) {
 }
 
 func main() {
+	// When invoked as ddn, act as the version-dispatching shim
+	if isShimInvocation() {
+		os.Exit(runShim(os.Args[1:]))
+	}
+
 	var rootCmd = &cobra.Command{
-		Use:   "ddnswitch [version]",
+		Use:   "ddnswitch [version | -]",
 		Short: "Switch between different versions of DDN CLI",
 		Long: `DDN CLI Switcher allows you to easily switch between different versions of the DDN CLI.
 Similar to tfswitch for Terraform, this tool helps manage multiple DDN CLI versions.`,
 		Args: cobra.ArbitraryArgs,
+		// Fill in everything not given as a flag from env vars and config files
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			err := validateOutputFormat(outputFormat)
+			if err == nil {
+				err = applyConfig(cmd.Flags())
+			}
+			// Callers asking for a document get errors as one too
+			if err != nil && outputFormat != outputTable {
+				printStructuredError(outputFormat, err)
+				os.Exit(1)
+			}
+			return err
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
+				// Prefer a pinned version from .ddn_cli_version
+				pinned, err := switchToPinnedVersion()
+				if err != nil {
+					log.Fatalf("Error: %v", err)
+				}
+				if pinned {
+					return
+				}
+
 				// Interactive mode - show available versions
 				if err := listAndSelectVersion(); err != nil {
 					log.Fatalf("Error: %v", err)
 				}
+			} else if args[0] == previousArg {
+				if err := switchToPrevious(); err != nil {
+					log.Fatalf("Error: %v", err)
+				}
 			} else {
 				// Direct version specification
 				targetVersion := args[0]
@@ -55,23 +86,127 @@ Similar to tfswitch for Terraform, this tool helps manage multiple DDN CLI versi
 
 	// Add the prerelease flag to the root command
 	rootCmd.PersistentFlags().BoolVar(&includePrerelease, "pre", false, "Include pre-release versions")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "How long to wait for another ddnswitch process to release the install directory")
+	rootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", cacheTTL, "How long the cached release index is used before it is revalidated")
+	rootCmd.PersistentFlags().StringVar(&releaseSourceSpec, "source", "", "Release index to use: github[:owner/repo], an http(s) URL, or a file:// URL or local path")
+	rootCmd.PersistentFlags().StringVar(&downloadURLTemplate, "download-url", downloadURLTemplate, "Download URL template with {version}, {os}, {arch} and {ext} placeholders")
+	rootCmd.PersistentFlags().StringArrayVar(&downloadMirrors, "mirror", nil, "Download URL template to try when the primary download fails (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&configuredBinDir, "bin-dir", "", "Directory on PATH for the ddn link, remembered for later switches")
+	rootCmd.PersistentFlags().BoolVar(&offlineMode, "offline", false, "Never use the network; work from installed versions and the cached release index")
+	rootCmd.PersistentFlags().BoolVar(&allowUnsignedIndex, "allow-unsigned-index", false, "Use a release index that can't be signature-verified (unsafe)")
+	rootCmd.PersistentFlags().BoolVar(&skipVerify, "skip-verify", false, "Install DDN CLI binaries without checksum verification (unsafe)")
+
+	var useCmd = &cobra.Command{
+		Use:   "use [version | -]",
+		Short: "Switch to a version, or to the one pinned in .ddn_cli_version",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 1 && args[0] == previousArg {
+				if err := switchToPrevious(); err != nil {
+					log.Fatalf("Error: %v", err)
+				}
+				return
+			}
+			if len(args) == 1 {
+				targetVersion := args[0]
+				fmt.Printf("Switching to DDN CLI version %s...\n", targetVersion)
+				if err := switchToVersion(targetVersion); err != nil {
+					log.Fatalf("Error switching to version %s: %v", targetVersion, err)
+				}
+				return
+			}
+
+			pinned, err := switchToPinnedVersion()
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if !pinned {
+				log.Fatalf("Error: no %s found in the current directory or any parent", pinFileName)
+			}
+		},
+	}
+
+	var previousCmd = &cobra.Command{
+		Use:   "previous",
+		Short: "Switch back to the previously active version (same as ddnswitch -)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := switchToPrevious(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	var historyLimit int
+	var historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "List recent switches with when and where they happened",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					return switchHistory(historyLimit), nil
+				})
+				return
+			}
+			printHistory(switchHistory(historyLimit))
+		},
+	}
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 10, "Number of switches to show (0 for all)")
 
+	var listInstalledOnly, listRemoteOnly bool
 	var listCmd = &cobra.Command{
 		Use:   "list",
-		Short: "List all available DDN CLI versions",
+		Short: "List DDN CLI versions, marking installed, active and unavailable ones",
+		Long: `List the releases in the index together with installed versions the index doesn't
+list, marking which are installed, which is active, and which have no build for this platform.
+--installed lists only installed versions without touching the network, and --remote only
+the release index.`,
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := listAvailableVersions(); err != nil {
+			scope, err := listScope(listInstalledOnly, listRemoteOnly)
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					if err != nil {
+						return nil, err
+					}
+					return listVersionRecords(scope)
+				})
+				return
+			}
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if err := listVersions(scope); err != nil {
 				log.Fatalf("Error listing versions: %v", err)
 			}
 		},
 	}
+	listCmd.Flags().BoolVar(&listInstalledOnly, "installed", false, "List only installed versions")
+	listCmd.Flags().BoolVar(&listRemoteOnly, "remote", false, "List only versions in the release index")
 
 	var installCmd = &cobra.Command{
 		Use:   "install [version]",
 		Short: "Install a specific version of DDN CLI",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			version := args[0]
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					version, err := resolveVersion(args[0])
+					if err != nil {
+						return nil, err
+					}
+					if err := installVersion(version); err != nil {
+						return nil, err
+					}
+					return versionRecord(version, isPrereleaseTag(version), activeVersion()), nil
+				})
+				return
+			}
+			version, err := resolveVersion(args[0])
+			if err != nil {
+				log.Fatalf("Error resolving version %s: %v", args[0], err)
+			}
 			if err := installVersion(version); err != nil {
 				log.Fatalf("Error installing version %s: %v", version, err)
 			}
@@ -82,6 +217,12 @@ Similar to tfswitch for Terraform, this tool helps manage multiple DDN CLI versi
 		Use:   "current",
 		Short: "Show currently active DDN CLI version",
 		Run: func(cmd *cobra.Command, args []string) {
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					return currentVersionRecord()
+				})
+				return
+			}
 			if err := showCurrentVersion(); err != nil {
 				log.Fatalf("Error getting current version: %v", err)
 			}
@@ -102,14 +243,261 @@ Similar to tfswitch for Terraform, this tool helps manage multiple DDN CLI versi
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			version := args[0]
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					if err := uninstallVersion(version); err != nil {
+						return nil, err
+					}
+					return VersionRecord{Tag: version, Prerelease: isPrereleaseTag(version)}, nil
+				})
+				return
+			}
 			if err := uninstallVersion(version); err != nil {
 				log.Fatalf("Error uninstalling version %s: %v", version, err)
 			}
 		},
 	}
 
+	var lsInstalledCmd = &cobra.Command{
+		Use:   "ls-installed",
+		Short: "List the DDN CLI versions installed locally",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if outputFormat != outputTable {
+				runStructured(outputFormat, func() (interface{}, error) {
+					return installedVersionRecords()
+				})
+				return
+			}
+			records, err := installedVersionRecords()
+			if err != nil {
+				log.Fatalf("Error listing installed versions: %v", err)
+			}
+			printInstalledTable(records)
+		},
+	}
+
+	for _, cmd := range []*cobra.Command{listCmd, currentCmd, installCmd, uninstallCmd, lsInstalledCmd, historyCmd} {
+		addOutputFlag(cmd)
+	}
+
+	var execCmd = &cobra.Command{
+		Use:   "exec <version> -- <args>",
+		Short: "Run a DDN CLI version once without switching to it",
+		Long: `Run a command with a specific DDN CLI version without changing the active one.
+The version is installed on demand. Everything after -- is passed to ddn.`,
+		Example: "  ddnswitch exec v2.9.0 -- supergraph build local",
+		Args:    cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			code, err := runVersion(args[0], args[1:])
+			if err != nil {
+				log.Fatalf("Error running version %s: %v", args[0], err)
+			}
+			os.Exit(code)
+		},
+	}
+
+	var envShell string
+	var envPin, envUnset bool
+	var envCmd = &cobra.Command{
+		Use:   "env <version>",
+		Short: "Print shell code that activates a version for the current shell only",
+		Long: `Print shell code that puts a DDN CLI version first on PATH for the current shell.
+The version is installed on demand, but the global ddn link is left untouched.`,
+		Example: `  eval "$(ddnswitch env v3.0.1)"
+  ddnswitch env v3.0.1 --shell fish | source
+  ddnswitch env v3.0.1 --shell powershell | Invoke-Expression`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			switch {
+			case envUnset:
+				if err := printUnsetEnv(envShell); err != nil {
+					log.Fatalf("Error: %v", err)
+				}
+			case envPin:
+				if err := printPinnedEnv(envShell); err != nil {
+					log.Fatalf("Error: %v", err)
+				}
+			case len(args) == 1:
+				if err := printVersionEnv(args[0], envShell); err != nil {
+					log.Fatalf("Error preparing environment for version %s: %v", args[0], err)
+				}
+			default:
+				log.Fatalf("Error: a version, --pin or --unset is required")
+			}
+		},
+	}
+	envCmd.Flags().StringVar(&envShell, "shell", "", "Shell syntax to print: bash, zsh, fish or powershell (default: detected)")
+	envCmd.Flags().BoolVar(&envPin, "pin", false, "Use the installed version pinned for the current directory, never downloading")
+	envCmd.Flags().BoolVar(&envUnset, "unset", false, "Drop any session version from PATH")
+
+	var hookCmd = &cobra.Command{
+		Use:   "hook [bash|zsh|fish]",
+		Short: "Print a shell hook that follows .ddn_cli_version as you change directories",
+		Example: `  eval "$(ddnswitch hook bash)"    # in ~/.bashrc
+  eval "$(ddnswitch hook zsh)"     # in ~/.zshrc
+  ddnswitch hook fish | source     # in ~/.config/fish/config.fish`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			shell := ""
+			if len(args) == 1 {
+				shell = args[0]
+			}
+			shell, err := normalizeShell(shell)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if err := printHook(shell); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	var lockCmd = &cobra.Command{
+		Use:   "lock [version]",
+		Short: "Write ddnswitch.lock with the version and per-platform checksums",
+		Long: `Write a ddnswitch.lock file recording the resolved DDN CLI version together with the
+download URL and SHA-256 of its binary for every supported platform. Installs and switches
+verify the binary against the lock before it is executed.
+
+Without a version the one pinned in .ddn_cli_version is locked, and the lock file is written
+next to the pin file.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			spec := ""
+			if len(args) == 1 {
+				spec = args[0]
+			}
+			if err := createLockFile(spec); err != nil {
+				log.Fatalf("Error writing lock file: %v", err)
+			}
+		},
+	}
+
+	var shimCmd = &cobra.Command{
+		Use:   "shim",
+		Short: "Manage the ddn shim that picks the version at run time",
+	}
+
+	var shimInstallCmd = &cobra.Command{
+		Use:   "install",
+		Short: "Replace the global ddn link with a version-dispatching shim",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := installShim(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	var shimUninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the shim and link ddn to the default version again",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := uninstallShim(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	shimCmd.AddCommand(shimInstallCmd, shimUninstallCmd)
+
+	var cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect or clear the cached release index",
+	}
+
+	var cacheInfoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "Show where the release index is cached and how old it is",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printCacheInfo(""); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	var cacheClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Delete the cached release index so the next command refetches it",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := clearCache(); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	cacheCmd.AddCommand(cacheInfoCmd, cacheClearCmd)
+
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Show or change settings in config.yaml or .ddnswitch.yaml",
+		Long: `Settings are read, in increasing precedence, from built-in defaults, the user config
+(~/.config/ddnswitch/config.yaml), the nearest project .ddnswitch.yaml, DDNSWITCH_* environment
+variables and command line flags.`,
+	}
+
+	var configGetCmd = &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the effective value of a setting",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printConfigValue(args[0]); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+
+	var configProject bool
+	var configSetCmd = &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Write a setting to the user config, or to .ddnswitch.yaml with --project",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := configFileForWrite(args[0], configProject)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if err := setConfigValue(path, args[0], args[1]); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			fmt.Printf("Set %s in %s\n", args[0], path)
+		},
+	}
+	configSetCmd.Flags().BoolVar(&configProject, "project", false, "Write to the project .ddnswitch.yaml instead of the user config")
+
+	var configListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List all settings with their effective values and where they come from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			printConfig("")
+		},
+	}
+
+	configCmd.AddCommand(configGetCmd, configSetCmd, configListCmd)
+
+	var doctorFix bool
+	var doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose PATH, links, installed versions, config, network and cache",
+		Long: `Doctor reports every ddn in PATH and which one wins, the state of the managed link,
+dangling links, installed versions, pin files affecting this directory, the effective
+configuration, whether the release index and download hosts are reachable, and the cache.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runDoctor(doctorFix); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		},
+	}
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Repair safe problems: dangling or missing links and non-executable binaries")
+
 	// Add subcommands
-	rootCmd.AddCommand(listCmd, installCmd, currentCmd, versionCmd, uninstallCmd)
+	rootCmd.AddCommand(cacheCmd, configCmd, doctorCmd, lockCmd, shimCmd, useCmd, previousCmd, historyCmd, execCmd, envCmd, hookCmd, listCmd, lsInstalledCmd, installCmd, currentCmd, versionCmd, uninstallCmd)
 
 	// Execute the command
 	if err := rootCmd.Execute(); err != nil {
@@ -18,6 +18,13 @@ var (
 	// downloadBinary is already declared in core.go
 )
 
+func TestMain(m *testing.M) {
+	// Tests that reach the real install directory must never move a
+	// developer's ~/.ddnswitch
+	migrateLegacyStoreOnce = func(dataDir string) {}
+	os.Exit(m.Run())
+}
+
 func TestGetHomeDir(t *testing.T) {
 	home, err := getHomeDir()
 	if err != nil {
@@ -35,6 +42,13 @@ func TestGetHomeDir(t *testing.T) {
 }
 
 func TestGetInstallDir(t *testing.T) {
+	// Never touch (or migrate) the real store
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv(homeEnvVar, "")
+
 	installDir, err := getInstallDir()
 	if err != nil {
 		t.Fatalf("Failed to get install directory: %v", err)
@@ -44,9 +58,9 @@ func TestGetInstallDir(t *testing.T) {
 		t.Fatal("Install directory is empty")
 	}
 
-	// Should end with .ddnswitch
-	if filepath.Base(installDir) != ".ddnswitch" {
-		t.Fatalf("Install directory should end with .ddnswitch, got: %s", installDir)
+	// Should follow the XDG data directory
+	if installDir != filepath.Join(home, ".local", "share", "ddnswitch") {
+		t.Fatalf("Install directory should be under ~/.local/share, got: %s", installDir)
 	}
 }
 
@@ -98,7 +112,7 @@ func TestDownloadBinary(t *testing.T) {
 	destPath := filepath.Join(tempDir, "ddn")
 
 	// Download the mock binary
-	err := downloadBinary(server.URL, destPath)
+	err := downloadBinary(server.URL, destPath, "")
 	if err != nil {
 		t.Fatalf("Failed to download binary: %v", err)
 	}
@@ -383,11 +397,23 @@ func TestInstallVersion(t *testing.T) {
 	// Save the original functions and restore them after the test
 	originalGetInstallDir := getInstallDir
 	originalDownloadBinary := downloadBinary
+	originalLookupChecksum := lookupChecksum
+	originalIndexAsset := indexAsset
 	defer func() {
 		getInstallDir = originalGetInstallDir
 		downloadBinary = originalDownloadBinary
+		lookupChecksum = originalLookupChecksum
+		indexAsset = originalIndexAsset
 	}()
 
+	// Mock lookupChecksum so no release index or checksum file is fetched
+	lookupChecksum = func(version, downloadURL, osName, archName string) (string, error) {
+		return strings.Repeat("a", 64), nil
+	}
+	indexAsset = func(version, osName, archName string) *Asset {
+		return nil
+	}
+
 	// Create a new variable of function type that can be assigned
 	getInstallDir = func() (string, error) {
 		return tempDir, nil
@@ -395,7 +421,7 @@ func TestInstallVersion(t *testing.T) {
 
 	// Mock downloadBinary to create a mock binary
 	downloadBinaryCalled := false
-	downloadBinary = func(url, destPath string) error {
+	downloadBinary = func(url, destPath, expectedSHA256 string) error {
 		downloadBinaryCalled = true
 
 		// Create a mock binary that returns the correct version
@@ -445,12 +471,19 @@ func TestCreateSymlink(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir := t.TempDir()
 
-	// Save the original function and restore it after the test
+	// Save the original functions and restore them after the test
+	originalGetInstallDir := getInstallDir
 	originalGetSymlinkPath := getSymlinkPath
 	defer func() {
+		getInstallDir = originalGetInstallDir
 		getSymlinkPath = originalGetSymlinkPath
 	}()
 
+	// The link location is recorded in the store, so keep that in the temp directory too
+	getInstallDir = func() (string, error) {
+		return filepath.Join(tempDir, "store"), nil
+	}
+
 	// Create a mock symlink path in the temp directory
 	symlinkPath := filepath.Join(tempDir, "ddn")
 	getSymlinkPath = func() (string, error) {
@@ -523,3 +556,84 @@ func TestCreateSymlink(t *testing.T) {
 		}
 	}
 }
+
+func TestSwitchToVersionRollsBackBrokenLink(t *testing.T) {
+	// Skip on Windows as this test relies on shell scripts
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	// Create a temporary directory for testing
+	tempDir := t.TempDir()
+
+	// Save the original functions and restore them after the test
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", "ddn")
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+
+	// A working version that is currently active
+	goodVersion := "v2.9.0"
+	goodBinPath := filepath.Join(tempDir, goodVersion, binName)
+	if err := os.MkdirAll(filepath.Dir(goodBinPath), 0755); err != nil {
+		t.Fatalf("Failed to create version directory: %v", err)
+	}
+	goodBinary := "#!/bin/sh\necho \"DDN CLI Version: " + goodVersion + "\"\n"
+	if err := os.WriteFile(goodBinPath, []byte(goodBinary), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary: %v", err)
+	}
+	if err := createSymlink(goodBinPath); err != nil {
+		t.Fatalf("Failed to create initial symlink: %v", err)
+	}
+	if err := writeDefaultVersion(goodVersion); err != nil {
+		t.Fatalf("Failed to write default version: %v", err)
+	}
+
+	// A version that works when run directly but breaks when run through the link
+	badVersion := "v2.28.0"
+	badBinPath := filepath.Join(tempDir, badVersion, binName)
+	if err := os.MkdirAll(filepath.Dir(badBinPath), 0755); err != nil {
+		t.Fatalf("Failed to create version directory: %v", err)
+	}
+	badBinary := "#!/bin/sh\ncase \"$0\" in\n  *" + badVersion + "*) echo \"DDN CLI Version: " + badVersion + "\" ;;\n  *) exit 1 ;;\nesac\n"
+	if err := os.WriteFile(badBinPath, []byte(badBinary), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary: %v", err)
+	}
+
+	if err := switchToVersion(badVersion); err == nil {
+		t.Fatal("Expected the switch to fail")
+	}
+
+	// The link is back on the working version
+	target, err := os.Readlink(symlinkPath)
+	if err != nil {
+		t.Fatalf("Failed to read symlink: %v", err)
+	}
+	if target != goodBinPath {
+		t.Fatalf("Symlink points to %s, expected rollback to %s", target, goodBinPath)
+	}
+
+	// The failed version doesn't become the default for the shim or doctor --fix
+	if defaultVersion, err := readDefaultVersion(); err != nil || defaultVersion != goodVersion {
+		t.Fatalf("Expected the default to stay %s, got %q (%v)", goodVersion, defaultVersion, err)
+	}
+
+	// No temporary links are left next to it
+	entries, err := os.ReadDir(filepath.Dir(symlinkPath))
+	if err != nil {
+		t.Fatalf("Failed to read symlink directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the ddn link, found %d entries", len(entries))
+	}
+}
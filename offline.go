@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// offlineMode keeps ddnswitch off the network. Everything works from the
+// installed versions and the cached release index, and only a download that
+// is truly needed fails.
+var offlineMode bool
+
+// isNetworkError reports whether err means the network is unreachable, as
+// opposed to a server answering with an error status
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// goOffline switches to offline mode for the rest of the process after a
+// network failure
+func goOffline(cause error) {
+	if offlineMode {
+		return
+	}
+	offlineMode = true
+	fmt.Fprintf(os.Stderr, "Warning: network unavailable, continuing offline (%v)\n", cause)
+}
+
+// offlineDownloadError is returned when offline mode meets a version that
+// isn't installed
+func offlineDownloadError(version string) error {
+	return withCode(codeOffline, fmt.Errorf("DDN CLI %s is not installed and can't be downloaded in offline mode", version))
+}
+
+// isVersionInstalled reports whether the binary of version is in the store
+func isVersionInstalled(version string) bool {
+	binPath, err := versionBinPath(version)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(binPath)
+	return err == nil
+}
+
+// installedReleases presents the installed versions as releases, for when
+// no release index is available offline
+func installedReleases() ([]Release, error) {
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Release
+	for _, version := range installed {
+		releases = append(releases, Release{TagName: version, Name: version, localOnly: true})
+	}
+	return releases, nil
+}
+
+// resolveOfflineVersion resolves spec against installed versions only
+func resolveOfflineVersion(spec string) (string, error) {
+	version, err := resolveInstalledVersion(spec)
+	if err != nil {
+		return "", withCode(codeOffline, fmt.Errorf("%w (offline mode)", err))
+	}
+	if version != normalizeTag(spec) {
+		fmt.Printf("Resolved %s to %s (installed)\n", spec, version)
+	}
+	return version, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setOfflineMode overrides offlineMode for the duration of a test
+func setOfflineMode(t *testing.T, offline bool) {
+	original := offlineMode
+	offlineMode = offline
+	t.Cleanup(func() {
+		offlineMode = original
+	})
+}
+
+func TestOfflineModeUsesInstalledVersions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	setOfflineMode(t, true)
+	installMockVersions(t, tempDir, "v3.0.0", "v2.9.0")
+
+	// No cached index, so the installed versions are all there is
+	releases, err := fetchAvailableVersions()
+	if err != nil {
+		t.Fatalf("Failed to list versions offline: %v", err)
+	}
+	if len(releases) != 2 || releases[0].TagName != "v3.0.0" {
+		t.Fatalf("Expected the installed versions, got %+v", releases)
+	}
+
+	resolved, err := resolveVersion("latest")
+	if err != nil {
+		t.Fatalf("Failed to resolve latest offline: %v", err)
+	}
+	if resolved != "v3.0.0" {
+		t.Fatalf("Expected latest installed v3.0.0, got %s", resolved)
+	}
+
+	if _, err := resolveVersion("~3.1"); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Fatalf("Expected an offline resolution error, got %v", err)
+	}
+
+	// A version that isn't installed would need a download
+	err = installVersion("v3.1.0")
+	if err == nil || !strings.Contains(err.Error(), "offline mode") {
+		t.Fatalf("Expected an offline install error, got %v", err)
+	}
+}
+
+func TestLoadReleaseIndexGoesOfflineOnNetworkFailure(t *testing.T) {
+	t.Setenv(indexPublicKeyEnvVar, "")
+	setOfflineMode(t, false)
+	serveReleaseIndex(t, `[]`)
+
+	// A stale cache for a server that is no longer reachable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	releasesURL = server.URL + "/releases.json"
+	server.Close()
+
+	index := `[{"tag_name":"v2.28.0"}]`
+	err := writeCachedIndex(&cachedIndex{
+		meta: indexCacheMeta{Source: releasesURL, FetchedAt: time.Now().Add(-48 * time.Hour)},
+		body: []byte(index),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+
+	body, err := loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Expected the stale cache to be used, got %v", err)
+	}
+	if string(body) != index {
+		t.Fatalf("Unexpected index: %q", body)
+	}
+	if !offlineMode {
+		t.Fatal("Expected a network failure to switch to offline mode")
+	}
+}
+
+func TestInstallGoesOfflineWhileLookingUpDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	originalIndexAsset := indexAsset
+	originalDownloadBinary := downloadBinary
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		indexAsset = originalIndexAsset
+		downloadBinary = originalDownloadBinary
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	setOfflineMode(t, false)
+	// The release index is first needed for the asset URL, and the network is down
+	indexAsset = func(version, osName, archName string) *Asset {
+		goOffline(errors.New("no such host"))
+		return nil
+	}
+	downloadBinary = func(url, destPath, expectedSHA256 string) error {
+		t.Fatalf("Unexpected download of %s in offline mode", url)
+		return nil
+	}
+
+	err := installVersion("v9.9.9")
+	if err == nil || errorCode(err) != codeOffline {
+		t.Fatalf("Expected an offline error, got %v", err)
+	}
+}
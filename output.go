@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// outputFormat is set by --output on the commands that support it
+var outputFormat = outputTable
+
+// Error codes reported in json and yaml output. Scripts match on these, so
+// never change an existing one.
+const (
+	codeError               = "error"
+	codeInvalidArgument     = "invalid_argument"
+	codeVersionNotFound     = "version_not_found"
+	codeNotInstalled        = "not_installed"
+	codeNoActiveVersion     = "no_active_version"
+	codeOffline             = "offline"
+	codeNetwork             = "network_error"
+	codeChecksumMismatch    = "checksum_mismatch"
+	codeUnsupportedPlatform = "unsupported_platform"
+	codeLockTimeout         = "lock_timeout"
+)
+
+// codedError attaches a stable error code to an error without changing its message
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+func (e *codedError) Unwrap() error { return e.err }
+
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// errorCode returns the code of the outermost coded error in err's chain,
+// so a wrapper can refine the code of the error it wraps
+func errorCode(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	if isNetworkError(err) {
+		return codeNetwork
+	}
+	return codeError
+}
+
+// VersionRecord describes a DDN CLI version in json and yaml output
+type VersionRecord struct {
+	Tag         string     `json:"tag" yaml:"tag"`
+	Prerelease  bool       `json:"prerelease" yaml:"prerelease"`
+	Installed   bool       `json:"installed" yaml:"installed"`
+	Active      bool       `json:"active" yaml:"active"`
+	Path        string     `json:"path,omitempty" yaml:"path,omitempty"`
+	Size        int64      `json:"size,omitempty" yaml:"size,omitempty"`
+	InstalledAt *time.Time `json:"installed_at,omitempty" yaml:"installed_at,omitempty"`
+	// Only known when the release index was read, as in `list`
+	Remote      *bool `json:"remote,omitempty" yaml:"remote,omitempty"`
+	Installable *bool `json:"installable,omitempty" yaml:"installable,omitempty"`
+}
+
+// isPrereleaseTag reports whether a tag has a semver pre-release suffix
+func isPrereleaseTag(tag string) bool {
+	v, err := semver.NewVersion(strings.TrimPrefix(tag, "v"))
+	return err == nil && v.Prerelease() != ""
+}
+
+// versionRecord builds the record of tag from the store. active is the
+// active version, as returned by activeVersion.
+func versionRecord(tag string, prerelease bool, active string) VersionRecord {
+	record := VersionRecord{Tag: tag, Prerelease: prerelease, Active: tag == active}
+	binPath, err := versionBinPath(tag)
+	if err != nil {
+		return record
+	}
+	if info, err := os.Stat(binPath); err == nil {
+		installedAt := info.ModTime().UTC()
+		record.Installed = true
+		record.Path = binPath
+		record.Size = info.Size()
+		record.InstalledAt = &installedAt
+	}
+	return record
+}
+
+// activeVersion returns the version the managed ddn link selects, or an
+// empty string when there is none. It trusts the state recorded by the last
+// switch and only looks at the link when it was changed since.
+func activeVersion() string {
+	symlinkPath, err := getSymlinkPath()
+	if err != nil {
+		return ""
+	}
+	if isShimLink(symlinkPath) {
+		spec, _, err := resolveShimVersion()
+		if err != nil {
+			return ""
+		}
+		version, err := resolveInstalledVersion(spec)
+		if err != nil {
+			return ""
+		}
+		return version
+	}
+	if state, ok := activeFromState(symlinkPath); ok {
+		return state.Active
+	}
+
+	// The link was changed outside ddnswitch, work it out from the link itself
+	target, err := os.Readlink(symlinkPath)
+	if err != nil {
+		return linkedCopyVersion(symlinkPath)
+	}
+	if !inStore(target) {
+		return ""
+	}
+	// A link left dangling by a removed version selects nothing
+	version := filepath.Base(filepath.Dir(target))
+	if !isVersionInstalled(version) {
+		return ""
+	}
+	return version
+}
+
+// linkedCopyVersion asks a copied ddn (used where symlinks aren't available)
+// for its version, once, and returns the installed version it reports
+func linkedCopyVersion(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	reported, err := probeVersion(path)
+	if err != nil {
+		debugLog("%v", err)
+		return ""
+	}
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return ""
+	}
+	for _, tag := range installed {
+		if sameVersion(reported, tag) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// installedVersionRecords lists the store as records, newest first
+func installedVersionRecords() ([]VersionRecord, error) {
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return nil, err
+	}
+	active := activeVersion()
+	records := []VersionRecord{}
+	for _, tag := range installed {
+		records = append(records, versionRecord(tag, isPrereleaseTag(tag), active))
+	}
+	return records, nil
+}
+
+// currentVersionRecord returns the record of the active version
+func currentVersionRecord() (VersionRecord, error) {
+	active := activeVersion()
+	if active == "" {
+		return VersionRecord{}, withCode(codeNoActiveVersion, fmt.Errorf("no DDN CLI version is active"))
+	}
+	return versionRecord(active, isPrereleaseTag(active), active), nil
+}
+
+// printInstalledTable prints installed versions for `ls-installed`
+func printInstalledTable(records []VersionRecord) {
+	if len(records) == 0 {
+		fmt.Println("No DDN CLI versions installed")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tACTIVE\tSIZE\tINSTALLED\tPATH")
+	for _, r := range records {
+		active := ""
+		if r.Active {
+			active = "*"
+		}
+		installedAt := ""
+		if r.InstalledAt != nil {
+			installedAt = r.InstalledAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f MB\t%s\t%s\n", r.Tag, active, float64(r.Size)/(1<<20), installedAt, r.Path)
+	}
+	w.Flush()
+}
+
+// addOutputFlag registers --output on cmd
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format: table, json or yaml")
+}
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return withCode(codeInvalidArgument, fmt.Errorf("unsupported output format %q (expected table, json or yaml)", format))
+}
+
+// writeDocument encodes v to w in format
+func writeDocument(w io.Writer, format string, v interface{}) error {
+	if format == outputYAML {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// errorDocument is how errors are reported in json and yaml output
+type errorDocument struct {
+	Error struct {
+		Code    string `json:"code" yaml:"code"`
+		Message string `json:"message" yaml:"message"`
+	} `json:"error" yaml:"error"`
+}
+
+// printStructured runs fn and prints its result as a json or yaml document,
+// or an error document when it fails, and returns fn's error. Messages meant
+// for humans go to stderr meanwhile, so stdout holds nothing but the document.
+func printStructured(format string, fn func() (interface{}, error)) error {
+	var result interface{}
+	err := withStdoutToStderr(func() error {
+		var err error
+		result, err = fn()
+		return err
+	})
+	if err == nil {
+		if err = writeDocument(os.Stdout, format, result); err == nil {
+			return nil
+		}
+	}
+
+	var doc errorDocument
+	doc.Error.Code = errorCode(err)
+	doc.Error.Message = err.Error()
+	writeDocument(os.Stdout, format, doc)
+	return err
+}
+
+// printStructuredError reports err, found before the command ran, as an error
+// document. An unsupported format is itself the error, so json is used then.
+func printStructuredError(format string, err error) error {
+	if validateOutputFormat(format) != nil {
+		format = outputJSON
+	}
+	return printStructured(format, func() (interface{}, error) {
+		return nil, err
+	})
+}
+
+// runStructured is printStructured for command handlers, exiting with status
+// 1 on failure
+func runStructured(format string, fn func() (interface{}, error)) {
+	if err := printStructured(format, fn); err != nil {
+		os.Exit(1)
+	}
+}
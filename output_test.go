@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestErrorCode(t *testing.T) {
+	notInstalled := withCode(codeNotInstalled, fmt.Errorf("no installed DDN CLI version satisfies %q", "~3.0"))
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{fmt.Errorf("something broke"), codeError},
+		{notInstalled, codeNotInstalled},
+		// Wrapping keeps the code, a coded wrapper refines it
+		{fmt.Errorf("failed to switch: %w", notInstalled), codeNotInstalled},
+		{withCode(codeOffline, fmt.Errorf("%w (offline mode)", notInstalled)), codeOffline},
+	}
+	for _, test := range tests {
+		if got := errorCode(test.err); got != test.expected {
+			t.Errorf("Expected code %s for %q, got %s", test.expected, test.err, got)
+		}
+	}
+
+	// Resolution failures carry their codes from where they happen
+	if _, err := resolveVersionImpl("not a version"); errorCode(err) != codeInvalidArgument {
+		t.Errorf("Expected %s for an invalid constraint, got %s (%v)", codeInvalidArgument, errorCode(err), err)
+	}
+}
+
+func TestInstalledVersionRecords(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+
+	installMockVersions(t, installDir, "v2.9.0", "v3.0.1", "v3.1.0-beta.1")
+	activeBinary, _ := versionBinPath("v3.0.1")
+	if err := createSymlinkAt(symlinkPath, activeBinary); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	records, err := installedVersionRecords()
+	if err != nil {
+		t.Fatalf("Failed to list installed versions: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", records)
+	}
+	for _, record := range records {
+		if !record.Installed || record.Path == "" || record.Size != int64(len("mock")) || record.InstalledAt == nil {
+			t.Fatalf("Expected installed details in %+v", record)
+		}
+		if record.Active != (record.Tag == "v3.0.1") {
+			t.Fatalf("Expected only v3.0.1 to be active, got %+v", record)
+		}
+		if record.Prerelease != (record.Tag == "v3.1.0-beta.1") {
+			t.Fatalf("Expected only v3.1.0-beta.1 to be a pre-release, got %+v", record)
+		}
+	}
+
+	current, err := currentVersionRecord()
+	if err != nil || current.Tag != "v3.0.1" {
+		t.Fatalf("Expected v3.0.1 to be current, got %+v (%v)", current, err)
+	}
+}
+
+func TestPrintStructured(t *testing.T) {
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	installDir := t.TempDir()
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+
+	records := []VersionRecord{{Tag: "v3.0.1", Installed: true, Active: true, Path: "/store/v3.0.1/ddn", Size: 42}}
+
+	// Human messages printed along the way stay out of the document
+	out, err := captureStdout(t, func() error {
+		return printStructured(outputJSON, func() (interface{}, error) {
+			fmt.Println("Fetching available DDN CLI versions...")
+			return records, nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to print records: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("Expected a JSON document, got %q: %v", out, err)
+	}
+	if decoded[0]["tag"] != "v3.0.1" || decoded[0]["active"] != true || decoded[0]["size"] != float64(42) {
+		t.Fatalf("Unexpected record: %v", decoded[0])
+	}
+	if _, ok := decoded[0]["installed_at"]; ok {
+		t.Fatal("Expected installed_at to be omitted when unknown")
+	}
+
+	// Errors become a document with a stable code
+	out, err = captureStdout(t, func() error {
+		return printStructured(outputYAML, func() (interface{}, error) {
+			return nil, uninstallVersion("v0.0.0-missing")
+		})
+	})
+	if err == nil {
+		t.Fatal("Expected the error to be returned")
+	}
+	var doc map[string]map[string]string
+	if err := yaml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("Expected a YAML document, got %q: %v", out, err)
+	}
+	if doc["error"]["code"] != codeNotInstalled || !strings.Contains(doc["error"]["message"], "not installed") {
+		t.Fatalf("Unexpected error document: %v", doc)
+	}
+}
+
+func TestPrintStructuredErrorWithInvalidFormat(t *testing.T) {
+	out, err := captureStdout(t, func() error {
+		return printStructuredError("xml", validateOutputFormat("xml"))
+	})
+	if err == nil {
+		t.Fatal("Expected the error to be returned")
+	}
+	var doc errorDocument
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("Expected a JSON document, got %q: %v", out, err)
+	}
+	if doc.Error.Code != codeInvalidArgument {
+		t.Fatalf("Unexpected error document: %+v", doc)
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{outputTable, outputJSON, outputYAML} {
+		if err := validateOutputFormat(format); err != nil {
+			t.Errorf("Expected %s to be accepted: %v", format, err)
+		}
+	}
+	if err := validateOutputFormat("xml"); errorCode(err) != codeInvalidArgument {
+		t.Errorf("Expected xml to be rejected as an invalid argument, got %v", err)
+	}
+}
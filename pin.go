@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const pinFileName = ".ddn_cli_version"
+
+// findUpwards walks up from dir to the filesystem root and returns the path of
+// the first file called name, or an empty string if there is none.
+func findUpwards(dir, name string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// findPinFile returns the nearest .ddn_cli_version at or above dir
+func findPinFile(dir string) (string, error) {
+	return findUpwards(dir, pinFileName)
+}
+
+// readPinFile returns the first non-empty, non-comment line of a pin file
+func readPinFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("pin file %s is empty", path)
+}
+
+// readPinSpec looks for a pin file starting at the current directory and
+// returns its raw contents. It returns an empty spec when no pin file exists.
+func readPinSpec() (string, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+
+	pinPath, err := findPinFile(cwd)
+	if err != nil {
+		return "", "", err
+	}
+	if pinPath == "" {
+		debugLog("No %s found above %s", pinFileName, cwd)
+		return "", "", nil
+	}
+	debugLog("Found pin file %s", pinPath)
+
+	version, err := readPinFile(pinPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	return version, pinPath, nil
+}
+
+// resolvePinnedVersion returns the version pinned for the current directory.
+// When a ddnswitch.lock next to the pin file was generated from the same pin,
+// its locked version is used so everyone runs the same release.
+func resolvePinnedVersion() (string, string, error) {
+	spec, pinPath, err := readPinSpec()
+	if err != nil || spec == "" {
+		return spec, pinPath, err
+	}
+
+	lockPath := filepath.Join(filepath.Dir(pinPath), lockFileName)
+	lock, err := readLockFile(lockPath)
+	if os.IsNotExist(err) {
+		return spec, pinPath, nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if lock.Constraint == spec || lock.Version == normalizeTag(spec) {
+		debugLog("Using locked version %s from %s", lock.Version, lockPath)
+		return lock.Version, pinPath, nil
+	}
+
+	debugLog("Lock file %s was generated for %q, ignoring it for %q", lockPath, lock.Constraint, spec)
+	return spec, pinPath, nil
+}
+
+// switchToPinnedVersion switches to the version pinned for the current
+// directory. It reports false when there is no pin file.
+func switchToPinnedVersion() (bool, error) {
+	version, pinPath, err := resolvePinnedVersion()
+	if err != nil {
+		return false, err
+	}
+	if version == "" {
+		return false, nil
+	}
+
+	fmt.Printf("Switching to DDN CLI version %s (pinned by %s)...\n", version, pinPath)
+	if err := switchToVersion(version); err != nil {
+		return true, fmt.Errorf("failed to switch to pinned version %s: %w", version, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindPinFileWalksUp(t *testing.T) {
+	root := t.TempDir()
+	pinPath := filepath.Join(root, pinFileName)
+	if err := os.WriteFile(pinPath, []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+
+	// Create a nested subproject without its own pin
+	nested := filepath.Join(root, "services", "api")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create nested directory: %v", err)
+	}
+
+	found, err := findPinFile(nested)
+	if err != nil {
+		t.Fatalf("Failed to find pin file: %v", err)
+	}
+	if found != pinPath {
+		t.Fatalf("Expected pin file %s, got %s", pinPath, found)
+	}
+
+	// A nearer pin file wins over the repo root
+	nestedPin := filepath.Join(nested, pinFileName)
+	if err := os.WriteFile(nestedPin, []byte("v2.9.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write nested pin file: %v", err)
+	}
+
+	found, err = findPinFile(nested)
+	if err != nil {
+		t.Fatalf("Failed to find pin file: %v", err)
+	}
+	if found != nestedPin {
+		t.Fatalf("Expected pin file %s, got %s", nestedPin, found)
+	}
+}
+
+func TestReadPinFile(t *testing.T) {
+	tempDir := t.TempDir()
+	pinPath := filepath.Join(tempDir, pinFileName)
+
+	content := "# pinned for the monorepo\n\n  v3.0.1  \n"
+	if err := os.WriteFile(pinPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+
+	version, err := readPinFile(pinPath)
+	if err != nil {
+		t.Fatalf("Failed to read pin file: %v", err)
+	}
+	if version != "v3.0.1" {
+		t.Fatalf("Expected v3.0.1, got %q", version)
+	}
+
+	// An empty pin file is an error
+	if err := os.WriteFile(pinPath, []byte("\n# nothing\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+	if _, err := readPinFile(pinPath); err == nil {
+		t.Fatal("Expected an error for an empty pin file")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// probeTimeout bounds how long a ddn binary may take to report its version
+var probeTimeout = 10 * time.Second
+
+// reportedVersionPattern finds a semver in `ddn version` output such as
+// "DDN CLI Version: v3.0.1". The word boundary keeps "go1.22.3" from matching.
+var reportedVersionPattern = regexp.MustCompile(`\bv?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)`)
+
+// probeKey identifies a binary by the path it is run as, what that resolves
+// to and its contents, so a reinstall or a switched link is probed again.
+// Running through a link is probed separately from running the target,
+// since that is what a switch has to verify.
+type probeKey struct {
+	path     string
+	resolved string
+	modTime  time.Time
+	size     int64
+}
+
+var (
+	probeCache    = map[probeKey]*semver.Version{}
+	probeCacheMux sync.Mutex
+)
+
+// probeVersion runs `binPath version` with a timeout and returns the version
+// it reports. Results are cached per binary for the rest of the process.
+var probeVersion = func(binPath string) (*semver.Version, error) {
+	return probeVersionImpl(binPath)
+}
+
+func probeVersionImpl(binPath string) (*semver.Version, error) {
+	resolved, err := filepath.EvalSymlinks(binPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	key := probeKey{path: binPath, resolved: resolved, modTime: info.ModTime(), size: info.Size()}
+
+	probeCacheMux.Lock()
+	cached, ok := probeCache[key]
+	probeCacheMux.Unlock()
+	if ok {
+		debugLog("Using cached version %s for %s", cached.Original(), binPath)
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binPath, "version")
+	// Don't wait forever on children that keep the output open
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s did not report its version within %v", binPath, probeTimeout)
+	}
+	if err != nil {
+		debugLog("Command output: %s", string(output))
+		return nil, fmt.Errorf("failed to run %s: %w", binPath, err)
+	}
+	debugLog("%s reports: %s", binPath, strings.TrimSpace(string(output)))
+
+	version, err := parseReportedVersion(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", binPath, err)
+	}
+
+	probeCacheMux.Lock()
+	probeCache[key] = version
+	probeCacheMux.Unlock()
+	return version, nil
+}
+
+// parseReportedVersion extracts the first strict semver from version output
+func parseReportedVersion(output string) (*semver.Version, error) {
+	for _, match := range reportedVersionPattern.FindAllStringSubmatch(output, -1) {
+		version, err := semver.StrictNewVersion(strings.TrimRight(match[1], ".-"))
+		if err == nil {
+			return version, nil
+		}
+	}
+	return nil, fmt.Errorf("no version found in output %q", strings.TrimSpace(output))
+}
+
+// sameVersion reports whether reported is exactly the release tag, so
+// v3.0.1 doesn't match v3.0.10
+func sameVersion(reported *semver.Version, tag string) bool {
+	expected, err := semver.NewVersion(strings.TrimPrefix(tag, "v"))
+	if err != nil {
+		return false
+	}
+	return reported.Equal(expected)
+}
+
+// errVersionMismatch is returned by checkBinaryVersion when the binary runs
+// but reports another version
+var errVersionMismatch = errors.New("version mismatch")
+
+// checkBinaryVersion probes binPath and returns an error unless it reports
+// exactly version. A binary that runs but reports another version gives an
+// error wrapping errVersionMismatch.
+func checkBinaryVersion(binPath, version string) error {
+	reported, err := probeVersion(binPath)
+	if err != nil {
+		return err
+	}
+	if !sameVersion(reported, version) {
+		return fmt.Errorf("%w: %s reports version %s, expected %s", errVersionMismatch, binPath, reported.Original(), version)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReportedVersion(t *testing.T) {
+	cases := map[string]string{
+		"DDN CLI Version: v3.0.1\n": "3.0.1",
+		"v3.1.0-rc.1":               "3.1.0-rc.1",
+		"built with go1.22.3\nDDN CLI Version: v3.0.10\n": "3.0.10",
+		"ddn version 2.28.0.":                             "2.28.0",
+		"DDN CLI Version: v2.9.0+build.7 (linux/amd64)\n": "2.9.0+build.7",
+	}
+	for output, expected := range cases {
+		version, err := parseReportedVersion(output)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", output, err)
+			continue
+		}
+		if version.String() != expected {
+			t.Errorf("Expected %s from %q, got %s", expected, output, version.String())
+		}
+	}
+
+	if _, err := parseReportedVersion("command not found"); err == nil {
+		t.Error("Expected an error when no version is reported")
+	}
+}
+
+func TestSameVersionIsExact(t *testing.T) {
+	reported, err := parseReportedVersion("DDN CLI Version: v3.0.10")
+	if err != nil {
+		t.Fatalf("Failed to parse version: %v", err)
+	}
+	if sameVersion(reported, "v3.0.1") {
+		t.Fatal("v3.0.10 must not match v3.0.1")
+	}
+	if !sameVersion(reported, "v3.0.10") || !sameVersion(reported, "3.0.10") {
+		t.Fatal("Expected v3.0.10 to match with or without the v prefix")
+	}
+
+	prerelease, _ := parseReportedVersion("v3.1.0-rc.1")
+	if sameVersion(prerelease, "v3.1.0") {
+		t.Fatal("A pre-release must not match the release")
+	}
+}
+
+func TestProbeVersionCachesPerBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	counter := filepath.Join(tempDir, "runs")
+	binPath := filepath.Join(tempDir, binName)
+	writeBinary := func(version string) {
+		script := "#!/bin/sh\necho run >> " + counter + "\necho \"DDN CLI Version: " + version + "\"\n"
+		if err := os.WriteFile(binPath, []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write mock binary: %v", err)
+		}
+	}
+	runs := func() int {
+		data, _ := os.ReadFile(counter)
+		return strings.Count(string(data), "run")
+	}
+
+	writeBinary("v3.0.1")
+	for i := 0; i < 3; i++ {
+		if err := checkBinaryVersion(binPath, "v3.0.1"); err != nil {
+			t.Fatalf("Expected v3.0.1: %v", err)
+		}
+	}
+	if runs() != 1 {
+		t.Fatalf("Expected the binary to run once, ran %d times", runs())
+	}
+
+	// A reinstalled binary is probed again
+	writeBinary("v3.0.10")
+	if err := checkBinaryVersion(binPath, "v3.0.1"); err == nil {
+		t.Fatal("Expected v3.0.10 not to match v3.0.1")
+	}
+	if runs() != 2 {
+		t.Fatalf("Expected the new binary to be probed, ran %d times", runs())
+	}
+}
+
+func TestProbeVersionTimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	originalTimeout := probeTimeout
+	probeTimeout = 100 * time.Millisecond
+	defer func() {
+		probeTimeout = originalTimeout
+	}()
+
+	binPath := filepath.Join(t.TempDir(), binName)
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\nsleep 10\n"), 0755); err != nil {
+		t.Fatalf("Failed to write mock binary: %v", err)
+	}
+
+	start := time.Now()
+	_, err := probeVersion(binPath)
+	if err == nil || !strings.Contains(err.Error(), "did not report its version") {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the probe to give up quickly, took %v", elapsed)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const latestVersion = "latest"
+
+// isExactVersion reports whether spec names a single release rather than a
+// constraint such as "~3.0" or ">=2.9 <3"
+func isExactVersion(spec string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(spec, "v"))
+	return err == nil
+}
+
+// normalizeTag makes sure an exact version carries the "v" prefix used by release tags
+func normalizeTag(spec string) string {
+	if strings.HasPrefix(spec, "v") {
+		return spec
+	}
+	return "v" + spec
+}
+
+// resolveVersion turns a version argument or pin file entry into a concrete
+// release tag. Exact versions are returned as-is; "latest" and semver
+// constraints are matched against installed versions first and then against
+// the remote release list.
+var resolveVersion = func(spec string) (string, error) {
+	return resolveVersionImpl(spec)
+}
+
+func resolveVersionImpl(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", withCode(codeInvalidArgument, fmt.Errorf("empty version"))
+	}
+
+	if isExactVersion(spec) {
+		return normalizeTag(spec), nil
+	}
+
+	if offlineMode {
+		return resolveOfflineVersion(spec)
+	}
+
+	if strings.EqualFold(spec, latestVersion) {
+		releases, err := fetchAvailableVersions()
+		if offlineMode {
+			// The network went away, so latest means the newest installed version
+			return resolveOfflineVersion(spec)
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(releases) == 0 {
+			return "", fmt.Errorf("no DDN CLI releases found")
+		}
+		fmt.Printf("Resolved %s to %s\n", spec, releases[0].TagName)
+		return releases[0].TagName, nil
+	}
+
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return "", withCode(codeInvalidArgument, fmt.Errorf("invalid version or constraint %q: %w", spec, err))
+	}
+
+	// Prefer what is already installed so pins like "~3.0" don't trigger downloads
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return "", err
+	}
+	if match := matchConstraint(constraint, installed); match != "" {
+		debugLog("Constraint %s satisfied by installed version %s", spec, match)
+		fmt.Printf("Resolved %s to %s (installed)\n", spec, match)
+		return match, nil
+	}
+
+	releases, err := fetchAvailableVersions()
+	if offlineMode {
+		return "", withCode(codeOffline, fmt.Errorf("no installed DDN CLI version satisfies %q (offline mode)", spec))
+	}
+	if err != nil {
+		return "", err
+	}
+	var tags []string
+	for _, release := range releases {
+		tags = append(tags, release.TagName)
+	}
+	if match := matchConstraint(constraint, tags); match != "" {
+		debugLog("Constraint %s satisfied by remote version %s", spec, match)
+		fmt.Printf("Resolved %s to %s\n", spec, match)
+		return match, nil
+	}
+
+	return "", withCode(codeVersionNotFound, fmt.Errorf("no DDN CLI version satisfies %q", spec))
+}
+
+// resolveInstalledVersion resolves spec against installed versions only. It
+// never touches the network, which makes it safe to call from the shim.
+func resolveInstalledVersion(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", withCode(codeInvalidArgument, fmt.Errorf("empty version"))
+	}
+
+	if isExactVersion(spec) {
+		return normalizeTag(spec), nil
+	}
+
+	installed, err := listInstalledVersions()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.EqualFold(spec, latestVersion) {
+		if len(installed) == 0 {
+			return "", withCode(codeNotInstalled, fmt.Errorf("no DDN CLI versions are installed"))
+		}
+		return installed[0], nil
+	}
+
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return "", withCode(codeInvalidArgument, fmt.Errorf("invalid version or constraint %q: %w", spec, err))
+	}
+	if match := matchConstraint(constraint, installed); match != "" {
+		return match, nil
+	}
+
+	return "", withCode(codeNotInstalled, fmt.Errorf("no installed DDN CLI version satisfies %q", spec))
+}
+
+// matchConstraint returns the newest tag satisfying the constraint
+func matchConstraint(constraint *semver.Constraints, tags []string) string {
+	var best *semver.Version
+	bestTag := ""
+	for _, tag := range tags {
+		v, err := semver.NewVersion(strings.TrimPrefix(tag, "v"))
+		if err != nil {
+			continue
+		}
+		if constraint.Check(v) && (best == nil || v.GreaterThan(best)) {
+			best = v
+			bestTag = tag
+		}
+	}
+	return bestTag
+}
+
+// listInstalledVersions returns the versions present in the install directory,
+// newest first
+func listInstalledVersions() ([]string, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(installPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install directory: %w", err)
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		binPath := filepath.Join(installPath, entry.Name(), binName)
+		if runtime.GOOS == "windows" {
+			binPath += ".exe"
+		}
+		if _, err := os.Stat(binPath); err != nil {
+			continue
+		}
+		versions = append(versions, entry.Name())
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		vi, err1 := semver.NewVersion(strings.TrimPrefix(versions[i], "v"))
+		vj, err2 := semver.NewVersion(strings.TrimPrefix(versions[j], "v"))
+		if err1 != nil || err2 != nil {
+			return versions[i] > versions[j]
+		}
+		return vi.GreaterThan(vj)
+	})
+
+	return versions, nil
+}
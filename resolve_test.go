@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// installMockVersions creates empty binaries for the given versions under dir
+func installMockVersions(t *testing.T, dir string, versions ...string) {
+	t.Helper()
+	for _, v := range versions {
+		versionDir := filepath.Join(dir, v)
+		if err := os.MkdirAll(versionDir, 0755); err != nil {
+			t.Fatalf("Failed to create version directory: %v", err)
+		}
+		binPath := filepath.Join(versionDir, binName)
+		if runtime.GOOS == "windows" {
+			binPath += ".exe"
+		}
+		if err := os.WriteFile(binPath, []byte("mock"), 0755); err != nil {
+			t.Fatalf("Failed to create mock binary: %v", err)
+		}
+	}
+}
+
+// primeVersionCache fills the in-memory release cache so tests don't hit the network
+func primeVersionCache(t *testing.T, tags ...string) {
+	t.Helper()
+	var releases []Release
+	for _, tag := range tags {
+		releases = append(releases, Release{TagName: tag})
+	}
+
+	versionCacheMux.Lock()
+	versionCache = releases
+	versionCacheTime = time.Now()
+	cachePrerelease = includePrerelease
+	versionCacheMux.Unlock()
+
+	t.Cleanup(func() {
+		versionCacheMux.Lock()
+		versionCache = nil
+		versionCacheTime = time.Time{}
+		versionCacheMux.Unlock()
+	})
+}
+
+func TestIsExactVersion(t *testing.T) {
+	cases := map[string]bool{
+		"v3.0.1":     true,
+		"3.0.1":      true,
+		"v3.1.0-rc1": true,
+		"~3.0":       false,
+		">=2.9 <3":   false,
+		"latest":     false,
+		"3.0":        false,
+	}
+	for spec, expected := range cases {
+		if got := isExactVersion(spec); got != expected {
+			t.Errorf("isExactVersion(%q) = %v, expected %v", spec, got, expected)
+		}
+	}
+}
+
+func TestMatchConstraint(t *testing.T) {
+	constraint, err := semver.NewConstraint(">=2.9 <3")
+	if err != nil {
+		t.Fatalf("Failed to parse constraint: %v", err)
+	}
+
+	tags := []string{"v3.0.1", "v2.9.0", "v2.10.3", "v2.8.0", "not-a-version"}
+	if match := matchConstraint(constraint, tags); match != "v2.10.3" {
+		t.Fatalf("Expected v2.10.3, got %q", match)
+	}
+}
+
+func TestResolveVersionPrefersInstalled(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	installMockVersions(t, tempDir, "v3.0.0", "v2.9.0")
+	primeVersionCache(t, "v3.0.5", "v3.0.0", "v2.9.0")
+
+	// An installed patch release satisfies the constraint, so no newer remote one is picked
+	resolved, err := resolveVersion("~3.0")
+	if err != nil {
+		t.Fatalf("Failed to resolve version: %v", err)
+	}
+	if resolved != "v3.0.0" {
+		t.Fatalf("Expected installed v3.0.0, got %s", resolved)
+	}
+
+	// Nothing installed satisfies this, so the remote list is used
+	resolved, err = resolveVersion(">3.0.0")
+	if err != nil {
+		t.Fatalf("Failed to resolve version: %v", err)
+	}
+	if resolved != "v3.0.5" {
+		t.Fatalf("Expected remote v3.0.5, got %s", resolved)
+	}
+
+	resolved, err = resolveVersion("latest")
+	if err != nil {
+		t.Fatalf("Failed to resolve latest: %v", err)
+	}
+	if resolved != "v3.0.5" {
+		t.Fatalf("Expected latest to be v3.0.5, got %s", resolved)
+	}
+
+	if _, err := resolveVersion("^4"); err == nil {
+		t.Fatal("Expected an error for an unsatisfiable constraint")
+	}
+}
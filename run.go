@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+)
+
+// runVersion runs the DDN CLI for spec with args without touching the active
+// symlink, installing the version first if needed. It returns the exit code
+// of the DDN CLI.
+func runVersion(spec string, args []string) (int, error) {
+	// Keep stdout for the DDN CLI; resolution and install progress go to stderr
+	var binPath string
+	err := withStdoutToStderr(func() error {
+		var err error
+		binPath, err = ensureVersionInstalled(spec)
+		return err
+	})
+	if err != nil {
+		return 1, err
+	}
+
+	debugLog("Executing %s with args %v", binPath, args)
+	return execBinary(binPath, args)
+}
+
+// ensureVersionInstalled resolves spec and goes through the same
+// install-on-demand path as switchToVersion, returning the path of its binary
+func ensureVersionInstalled(spec string) (string, error) {
+	version, err := resolveVersion(spec)
+	if err != nil {
+		return "", err
+	}
+	return prepareVersion(version)
+}
+
+// withStdoutToStderr runs fn with progress output redirected to stderr, for
+// commands whose stdout is consumed by another program
+func withStdoutToStderr(fn func() error) error {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = stdout
+	}()
+	return fn()
+}
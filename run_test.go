@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEnsureVersionInstalledInstallsOnDemand(t *testing.T) {
+	// Skip on Windows as this test relies on shell scripts
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	originalInstallVersion := installVersion
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		installVersion = originalInstallVersion
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	installCalls := 0
+	installVersion = func(version string) error {
+		installCalls++
+		versionDir := filepath.Join(tempDir, version)
+		if err := os.MkdirAll(versionDir, 0755); err != nil {
+			return err
+		}
+		mockBinaryContent := "#!/bin/sh\necho \"DDN CLI Version: " + version + "\"\n"
+		return os.WriteFile(filepath.Join(versionDir, binName), []byte(mockBinaryContent), 0755)
+	}
+
+	binPath, err := ensureVersionInstalled("v2.9.0")
+	if err != nil {
+		t.Fatalf("Failed to ensure version: %v", err)
+	}
+	if installCalls != 1 {
+		t.Fatalf("Expected one install, got %d", installCalls)
+	}
+	if filepath.Dir(binPath) != filepath.Join(tempDir, "v2.9.0") {
+		t.Fatalf("Unexpected binary path %s", binPath)
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		t.Fatalf("Binary missing after install: %v", err)
+	}
+
+	// A second run reuses the installed binary
+	if _, err := ensureVersionInstalled("v2.9.0"); err != nil {
+		t.Fatalf("Failed to ensure version: %v", err)
+	}
+	if installCalls != 1 {
+		t.Fatalf("Expected the installed version to be reused, got %d installs", installCalls)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// versionEnvVar overrides the version picked by the shim for a single command or shell
+	versionEnvVar = "DDN_CLI_VERSION"
+	// defaultVersionFile holds the global default version inside the install directory
+	defaultVersionFile = "default"
+)
+
+// isShimInvocation reports whether ddnswitch was started through the ddn shim
+func isShimInvocation() bool {
+	name := filepath.Base(os.Args[0])
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	}
+	return name == binName
+}
+
+// runShim resolves the DDN CLI version for this invocation and execs it
+func runShim(args []string) int {
+	// The shim has no flags, but config and env still decide where versions live
+	if err := applyConfig(nil); err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: %v\n", err)
+		return 1
+	}
+
+	spec, source, err := resolveShimVersion()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: %v\n", err)
+		return 1
+	}
+	debugLog("Shim resolved %s from %s", spec, source)
+
+	version, err := resolveInstalledVersion(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: %v (selected by %s)\n", err, source)
+		fmt.Fprintf(os.Stderr, "ddnswitch: run `ddnswitch install %q` to install it\n", spec)
+		return 1
+	}
+
+	binPath, err := versionBinPath(version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(binPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "ddnswitch: DDN CLI %s is not installed (selected by %s)\n", version, source)
+		fmt.Fprintf(os.Stderr, "ddnswitch: run `ddnswitch install %s` to install it\n", version)
+		return 1
+	}
+
+	// Never run bytes that don't match the lock file
+	if err := checkLockedBinary(version, binPath); err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: %v\n", err)
+		return 1
+	}
+
+	code, err := execBinary(binPath, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddnswitch: failed to run %s: %v\n", binPath, err)
+		return 1
+	}
+	return code
+}
+
+// resolveShimVersion picks the version spec from DDN_CLI_VERSION, the nearest
+// pin file, or the global default, in that order. The second return value
+// describes where the spec came from.
+func resolveShimVersion() (string, string, error) {
+	if spec := strings.TrimSpace(os.Getenv(versionEnvVar)); spec != "" {
+		return spec, versionEnvVar, nil
+	}
+
+	spec, pinPath, err := resolvePinnedVersion()
+	if err != nil {
+		return "", "", err
+	}
+	if spec != "" {
+		return spec, pinPath, nil
+	}
+
+	spec, err = readDefaultVersion()
+	if err != nil {
+		return "", "", err
+	}
+	if spec != "" {
+		return spec, "global default", nil
+	}
+
+	return "", "", fmt.Errorf("no DDN CLI version selected; run `ddnswitch <version>` or create a %s file", pinFileName)
+}
+
+// versionBinPath returns where the ddn binary for version lives in the store
+func versionBinPath(version string) (string, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return "", err
+	}
+
+	binPath := filepath.Join(installPath, version, binName)
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+	return binPath, nil
+}
+
+// readDefaultVersion returns the global default version, or an empty string if none is set
+func readDefaultVersion() (string, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(installPath, defaultVersionFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read default version: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeDefaultVersion records version as the global default used by the shim
+func writeDefaultVersion(version string) error {
+	if err := ensureInstallDir(); err != nil {
+		return err
+	}
+
+	installPath, err := getInstallDir()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(installPath, defaultVersionFile)
+	debugLog("Writing default version %s to %s", version, path)
+	return os.WriteFile(path, []byte(version+"\n"), 0644)
+}
+
+// selfExecutable returns the resolved path of the running ddnswitch binary
+func selfExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// isShimLink reports whether the ddn link at symlinkPath dispatches through ddnswitch
+func isShimLink(symlinkPath string) bool {
+	target, err := filepath.EvalSymlinks(symlinkPath)
+	if err != nil {
+		return false
+	}
+
+	self, err := selfExecutable()
+	if err != nil {
+		return false
+	}
+
+	if target == self {
+		return true
+	}
+
+	// Without symlink support the shim is a copy of ddnswitch
+	targetInfo, err1 := os.Stat(target)
+	selfInfo, err2 := os.Stat(self)
+	return err1 == nil && err2 == nil && targetInfo.Size() == selfInfo.Size() && filesEqual(target, self)
+}
+
+// filesEqual compares two files byte by byte
+func filesEqual(a, b string) bool {
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return false
+	}
+	return string(dataA) == string(dataB)
+}
+
+// installShim points the ddn link at ddnswitch itself so the version is
+// picked per invocation instead of by a global switch
+func installShim() error {
+	self, err := selfExecutable()
+	if err != nil {
+		return fmt.Errorf("failed to locate ddnswitch executable: %w", err)
+	}
+
+	symlinkPath, err := getSymlinkPath()
+	if err != nil {
+		return fmt.Errorf("failed to determine symlink path: %w", err)
+	}
+
+	if isShimLink(symlinkPath) {
+		fmt.Printf("Shim already installed at %s\n", symlinkPath)
+		return nil
+	}
+
+	// Keep whatever version was active as the global default
+	if defaultVersion, err := readDefaultVersion(); err == nil && defaultVersion == "" {
+		// Only a link into the store names a version, and only if it is still installed
+		if target, err := os.Readlink(symlinkPath); err == nil && inStore(target) && isVersionInstalled(filepath.Base(filepath.Dir(target))) {
+			version := filepath.Base(filepath.Dir(target))
+			debugLog("Recording previously active version %s as default", version)
+			if err := writeDefaultVersion(version); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := createSymlink(self); err != nil {
+		return fmt.Errorf("failed to install shim: %w", err)
+	}
+
+	fmt.Printf("Installed ddn shim at %s\n", symlinkPath)
+	fmt.Printf("The version is now picked from %s, %s or the global default at run time\n", versionEnvVar, pinFileName)
+	warnIfShadowed(symlinkPath)
+	return nil
+}
+
+// uninstallShim replaces the shim with a direct link to the global default version
+func uninstallShim() error {
+	symlinkPath, err := getSymlinkPath()
+	if err != nil {
+		return fmt.Errorf("failed to determine symlink path: %w", err)
+	}
+
+	if !isShimLink(symlinkPath) {
+		return fmt.Errorf("no ddn shim installed at %s", symlinkPath)
+	}
+
+	version, err := readDefaultVersion()
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		if err := os.Remove(symlinkPath); err != nil {
+			return fmt.Errorf("failed to remove shim: %w", err)
+		}
+		fmt.Printf("Removed ddn shim from %s\n", symlinkPath)
+		return nil
+	}
+
+	binPath, err := versionBinPath(version)
+	if err != nil {
+		return err
+	}
+	if err := createSymlink(binPath); err != nil {
+		return fmt.Errorf("failed to link version %s: %w", version, err)
+	}
+
+	fmt.Printf("Removed ddn shim, %s now links to DDN CLI %s\n", symlinkPath, version)
+	return nil
+}
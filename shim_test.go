@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// chdirForTest changes the working directory for the duration of a test
+func chdirForTest(t *testing.T, dir string) {
+	t.Helper()
+	original, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(original)
+	})
+}
+
+func TestResolveShimVersionPrecedence(t *testing.T) {
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	getInstallDir = func() (string, error) {
+		return filepath.Join(tempDir, ".ddnswitch"), nil
+	}
+
+	// Run from a directory without any pin file above it
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project directory: %v", err)
+	}
+	chdirForTest(t, projectDir)
+	t.Setenv(versionEnvVar, "")
+
+	if _, _, err := resolveShimVersion(); err == nil {
+		t.Fatal("Expected an error when no version is selected")
+	}
+
+	// The global default is the last resort
+	if err := writeDefaultVersion("v2.9.0"); err != nil {
+		t.Fatalf("Failed to write default version: %v", err)
+	}
+	spec, _, err := resolveShimVersion()
+	if err != nil {
+		t.Fatalf("Failed to resolve shim version: %v", err)
+	}
+	if spec != "v2.9.0" {
+		t.Fatalf("Expected global default v2.9.0, got %s", spec)
+	}
+
+	// A pin file beats the global default
+	if err := os.WriteFile(filepath.Join(projectDir, pinFileName), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pin file: %v", err)
+	}
+	spec, _, err = resolveShimVersion()
+	if err != nil {
+		t.Fatalf("Failed to resolve shim version: %v", err)
+	}
+	if spec != "v3.0.1" {
+		t.Fatalf("Expected pinned v3.0.1, got %s", spec)
+	}
+
+	// The environment variable beats everything
+	t.Setenv(versionEnvVar, "v3.0.0")
+	spec, source, err := resolveShimVersion()
+	if err != nil {
+		t.Fatalf("Failed to resolve shim version: %v", err)
+	}
+	if spec != "v3.0.0" || source != versionEnvVar {
+		t.Fatalf("Expected v3.0.0 from %s, got %s from %s", versionEnvVar, spec, source)
+	}
+}
+
+func TestInstallShimKeepsOnlyInstalledDefault(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+	installMockVersions(t, installDir, "v3.0.1")
+
+	// A ddn installed some other way says nothing about the default
+	if err := createSymlinkAt(symlinkPath, filepath.Join(tempDir, "usr", "bin", binName)); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := installShim(); err != nil {
+		t.Fatalf("Failed to install shim: %v", err)
+	}
+	if defaultVersion, _ := readDefaultVersion(); defaultVersion != "" {
+		t.Fatalf("Expected no default from a link outside the store, got %s", defaultVersion)
+	}
+
+	// A link to an installed version becomes the default
+	binPath, _ := versionBinPath("v3.0.1")
+	if err := createSymlinkAt(symlinkPath, binPath); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := installShim(); err != nil {
+		t.Fatalf("Failed to install shim: %v", err)
+	}
+	if defaultVersion, _ := readDefaultVersion(); defaultVersion != "v3.0.1" {
+		t.Fatalf("Expected the linked v3.0.1 as default, got %s", defaultVersion)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexPublicKey is the trusted key for the release index signature. It is
+// embedded at build time with -ldflags "-X main.indexPublicKey=<key>" and
+// accepts a minisign public key or a base64 raw ed25519 key.
+var indexPublicKey = ""
+
+// indexSignatureRequired is set to "true" with -ldflags in release builds, so
+// a shipped build that ended up without a key refuses the index instead of
+// silently skipping verification
+var indexSignatureRequired = ""
+
+// allowUnsignedIndex opts out of refusing a release index that can't be verified
+var allowUnsignedIndex bool
+
+// warnUnverifiedOnce keeps the unverified index warning to once per process
+var warnUnverifiedOnce sync.Once
+
+const (
+	// indexPublicKeyEnvVar overrides the embedded release index key
+	indexPublicKeyEnvVar = "DDNSWITCH_INDEX_PUBKEY"
+	// indexSignatureSuffix is appended to the index URL to find its detached signature
+	indexSignatureSuffix = ".minisig"
+)
+
+// minisign uses "Ed" for signatures over the raw message
+var minisignAlgorithm = []byte("Ed")
+
+type publicKey struct {
+	keyID []byte
+	key   ed25519.PublicKey
+}
+
+// trustedIndexKey returns the configured release index key, or nil when
+// signature verification is not configured
+func trustedIndexKey() (*publicKey, error) {
+	encoded := indexPublicKey
+	if override := strings.TrimSpace(os.Getenv(indexPublicKeyEnvVar)); override != "" {
+		debugLog("Using release index key from %s", indexPublicKeyEnvVar)
+		encoded = override
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	return parsePublicKey(encoded)
+}
+
+// decodeMinisignLine returns the base64 payload of a minisign file, skipping comment lines
+func decodeMinisignLine(data string) ([]byte, error) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(line)
+	}
+	return nil, fmt.Errorf("no key or signature data found")
+}
+
+// parsePublicKey accepts a minisign public key ("Ed" + key ID + key) or a raw
+// 32-byte ed25519 key, base64 encoded
+func parsePublicKey(encoded string) (*publicKey, error) {
+	raw, err := decodeMinisignLine(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release index public key: %w", err)
+	}
+
+	switch {
+	case len(raw) == ed25519.PublicKeySize:
+		return &publicKey{key: ed25519.PublicKey(raw)}, nil
+	case len(raw) == 2+8+ed25519.PublicKeySize && bytes.Equal(raw[:2], minisignAlgorithm):
+		return &publicKey{keyID: raw[2:10], key: ed25519.PublicKey(raw[10:])}, nil
+	default:
+		return nil, fmt.Errorf("invalid release index public key: unexpected length %d", len(raw))
+	}
+}
+
+// verifyIndexSignature checks a detached minisign or raw ed25519 signature over body
+func verifyIndexSignature(key *publicKey, body, signature []byte) error {
+	raw, err := decodeMinisignLine(string(signature))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	var sig []byte
+	switch {
+	case len(raw) == ed25519.SignatureSize:
+		sig = raw
+	case len(raw) == 2+8+ed25519.SignatureSize:
+		if !bytes.Equal(raw[:2], minisignAlgorithm) {
+			return fmt.Errorf("unsupported signature algorithm %q; sign the index with `minisign -S -l`", raw[:2])
+		}
+		if key.keyID != nil && !bytes.Equal(raw[2:10], key.keyID) {
+			return fmt.Errorf("signature was made with key %X, expected %X", raw[2:10], key.keyID)
+		}
+		sig = raw[10:]
+	default:
+		return fmt.Errorf("invalid signature: unexpected length %d", len(raw))
+	}
+
+	if !ed25519.Verify(key.key, body, sig) {
+		return fmt.Errorf("signature does not match the release index")
+	}
+	return nil
+}
+
+// fetchIndexSignature downloads the detached signature published next to the index
+var fetchIndexSignature = func(indexURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	url := indexURL + indexSignatureSuffix
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signature %s: HTTP status %d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 4096))
+}
+
+// checkIndexSignature refuses an index whose signature doesn't verify, or
+// that isn't signed at all, when a trusted key is configured. It returns the
+// verified signature so it can be cached next to the index, or nil when there
+// is nothing to verify.
+func checkIndexSignature(source ReleaseSource, body []byte) ([]byte, error) {
+	key, err := trustedIndexKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		if indexSignatureRequired == "true" && !allowUnsignedIndex {
+			return nil, fmt.Errorf("refusing to use release index from %s: this build has no trusted key to verify it; set %s or pass --allow-unsigned-index", source, indexPublicKeyEnvVar)
+		}
+		warnUnverifiedIndex(source, "no trusted key is configured")
+		return nil, nil
+	}
+
+	signature, err := source.Signature()
+	if errors.Is(err, errUnsignedSource) {
+		// Picking an unsigned source must not be a way around the trusted key
+		if !allowUnsignedIndex {
+			return nil, fmt.Errorf("refusing to use release index from %s: it can't be verified against the trusted key; pass --allow-unsigned-index to use it anyway", source)
+		}
+		warnUnverifiedIndex(source, "the source doesn't publish a signature")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("release index signature unavailable: %w", err)
+	}
+
+	if err := verifyIndexSignature(key, body, signature); err != nil {
+		return nil, fmt.Errorf("refusing to use release index from %s: %w", source, err)
+	}
+
+	debugLog("Release index signature verified")
+	return signature, nil
+}
+
+// warnUnverifiedIndex tells the user that the index is used without a
+// signature check, once per process
+func warnUnverifiedIndex(source ReleaseSource, reason string) {
+	warnUnverifiedOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "Warning: release index from %s is not signature-verified (%s)\n", source, reason)
+	})
+}
+
+// checkCachedIndexSignature verifies a cached index against its cached
+// signature, so a tampered cache is never trusted either
+func checkCachedIndexSignature(body, signature []byte) error {
+	key, err := trustedIndexKey()
+	if err != nil || key == nil {
+		return err
+	}
+	if len(signature) == 0 {
+		if allowUnsignedIndex {
+			return nil
+		}
+		return fmt.Errorf("cached release index has no signature")
+	}
+	return verifyIndexSignature(key, body, signature)
+}
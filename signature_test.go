@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// minisignFixture creates a key pair in minisign's legacy "Ed" format
+func minisignFixture(t *testing.T) (string, func(body []byte) []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	pubKey := "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)) + "\n"
+
+	sign := func(body []byte) []byte {
+		sig := append(append([]byte("Ed"), keyID...), ed25519.Sign(priv, body)...)
+		return []byte("untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(sig) + "\n" +
+			"trusted comment: timestamp:1700000000\n")
+	}
+	return pubKey, sign
+}
+
+func TestVerifyIndexSignature(t *testing.T) {
+	pubKey, sign := minisignFixture(t)
+	key, err := parsePublicKey(pubKey)
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+
+	body := []byte(`[{"tag_name":"v3.0.1"}]`)
+	signature := sign(body)
+
+	if err := verifyIndexSignature(key, body, signature); err != nil {
+		t.Fatalf("Valid signature was rejected: %v", err)
+	}
+
+	tampered := []byte(`[{"tag_name":"v6.6.6"}]`)
+	if err := verifyIndexSignature(key, tampered, signature); err == nil {
+		t.Fatal("Signature over a different index was accepted")
+	}
+
+	// A signature from another key is rejected by key ID
+	_, otherSign := minisignFixture(t)
+	if err := verifyIndexSignature(key, body, otherSign(body)); err == nil {
+		t.Fatal("Signature from another key was accepted")
+	}
+}
+
+func TestCheckIndexSignature(t *testing.T) {
+	pubKey, sign := minisignFixture(t)
+	body := []byte(`[{"tag_name":"v3.0.1"}]`)
+
+	originalFetchIndexSignature := fetchIndexSignature
+	defer func() {
+		fetchIndexSignature = originalFetchIndexSignature
+	}()
+	fetchIndexSignature = func(indexURL string) ([]byte, error) {
+		return sign([]byte(`[{"tag_name":"v6.6.6"}]`)), nil
+	}
+
+	// Without a trusted key nothing is checked
+	t.Setenv(indexPublicKeyEnvVar, "")
+	if _, err := checkIndexSignature(&urlSource{url: "https://example.com/releases.json"}, body); err != nil {
+		t.Fatalf("Expected no verification without a key, got %v", err)
+	}
+
+	// Release builds refuse to go without a key unless told to
+	originalRequired := indexSignatureRequired
+	originalAllow := allowUnsignedIndex
+	defer func() {
+		indexSignatureRequired = originalRequired
+		allowUnsignedIndex = originalAllow
+	}()
+	indexSignatureRequired = "true"
+	if _, err := checkIndexSignature(&urlSource{url: "https://example.com/releases.json"}, body); err == nil {
+		t.Fatal("Expected a release build without a key to refuse the index")
+	}
+	allowUnsignedIndex = true
+	if _, err := checkIndexSignature(&urlSource{url: "https://example.com/releases.json"}, body); err != nil {
+		t.Fatalf("Expected --allow-unsigned-index to accept the index, got %v", err)
+	}
+	allowUnsignedIndex = false
+
+	t.Setenv(indexPublicKeyEnvVar, pubKey)
+	_, err := checkIndexSignature(&urlSource{url: "https://example.com/releases.json"}, body)
+	if err == nil || !strings.Contains(err.Error(), "refusing to use release index") {
+		t.Fatalf("Expected the index to be refused, got %v", err)
+	}
+
+	fetchIndexSignature = func(indexURL string) ([]byte, error) {
+		return sign(body), nil
+	}
+	signature, err := checkIndexSignature(&urlSource{url: "https://example.com/releases.json"}, body)
+	if err != nil {
+		t.Fatalf("Valid index was refused: %v", err)
+	}
+
+	// The returned signature is what gets cached and re-checked later
+	if err := checkCachedIndexSignature(body, signature); err != nil {
+		t.Fatalf("Cached signature was rejected: %v", err)
+	}
+	if err := checkCachedIndexSignature([]byte(`[{"tag_name":"v6.6.6"}]`), signature); err == nil {
+		t.Fatal("Tampered cached index was accepted")
+	}
+}
+
+func TestUnsignedSourceNeedsOptOutWithKey(t *testing.T) {
+	pubKey, _ := minisignFixture(t)
+	body := []byte(`[{"tag_name":"v3.0.1"}]`)
+	source := &githubSource{repo: "acme/ddn"}
+
+	originalAllow := allowUnsignedIndex
+	defer func() {
+		allowUnsignedIndex = originalAllow
+	}()
+	allowUnsignedIndex = false
+
+	// Without a key there is nothing to get around
+	t.Setenv(indexPublicKeyEnvVar, "")
+	if _, err := checkIndexSignature(source, body); err != nil {
+		t.Fatalf("Expected an unsigned source to be used without a key, got %v", err)
+	}
+
+	// With a key, switching to a source that can't be signed doesn't skip verification
+	t.Setenv(indexPublicKeyEnvVar, pubKey)
+	if _, err := checkIndexSignature(source, body); err == nil || !strings.Contains(err.Error(), "--allow-unsigned-index") {
+		t.Fatalf("Expected the unsigned source to be refused, got %v", err)
+	}
+	if err := checkCachedIndexSignature(body, nil); err == nil {
+		t.Fatal("Expected an unsigned cached index to be refused")
+	}
+
+	allowUnsignedIndex = true
+	if _, err := checkIndexSignature(source, body); err != nil {
+		t.Fatalf("Expected --allow-unsigned-index to accept the source, got %v", err)
+	}
+	if err := checkCachedIndexSignature(body, nil); err != nil {
+		t.Fatalf("Expected --allow-unsigned-index to accept the cached index, got %v", err)
+	}
+}
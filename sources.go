@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// githubSourcePrefix selects the GitHub Releases API, optionally followed by ":owner/repo"
+	githubSourcePrefix = "github"
+	defaultGitHubRepo  = "hasura/ddn"
+	githubTokenEnvVar  = "GITHUB_TOKEN"
+	// localIndexFileName is read when a local source points at a directory
+	localIndexFileName = "releases.json"
+)
+
+// githubAPIURL is a variable so tests can point it at a local server
+var githubAPIURL = "https://api.github.com"
+
+// releaseSourceSpec selects where the release index comes from: empty for the
+// default index, "github[:owner/repo]", an http(s) URL, or a file:// URL or path
+var releaseSourceSpec string
+
+// errUnsignedSource is returned by sources that can't publish a detached signature
+var errUnsignedSource = errors.New("release source does not publish a signed index")
+
+// ReleaseSource is somewhere a release index can be fetched from. The index
+// is always a JSON array of releases in the GitHub Releases API format.
+type ReleaseSource interface {
+	// String names the source in messages and keys the on-disk cache
+	String() string
+	// Fetch returns the index, making a conditional request when validators are given
+	Fetch(validators *indexCacheMeta) (*indexResponse, error)
+	// Signature returns the detached signature of the index, or errUnsignedSource
+	Signature() ([]byte, error)
+	// Cacheable reports whether the index is worth keeping in the on-disk cache
+	Cacheable() bool
+}
+
+// currentReleaseSource returns the source selected with --source
+func currentReleaseSource() (ReleaseSource, error) {
+	return parseReleaseSource(releaseSourceSpec)
+}
+
+func parseReleaseSource(spec string) (ReleaseSource, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return &urlSource{url: releasesURL}, nil
+	case spec == githubSourcePrefix:
+		return &githubSource{repo: defaultGitHubRepo}, nil
+	case strings.HasPrefix(spec, githubSourcePrefix+":"):
+		repo := strings.TrimPrefix(spec, githubSourcePrefix+":")
+		if strings.Count(repo, "/") != 1 || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+			return nil, fmt.Errorf("invalid GitHub repository %q, expected owner/repo", repo)
+		}
+		return &githubSource{repo: repo}, nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return &urlSource{url: spec}, nil
+	case strings.HasPrefix(spec, "file://"):
+		path, err := fileURLPath(spec)
+		if err != nil {
+			return nil, err
+		}
+		return newLocalSource(path)
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("unsupported release source %q", spec)
+	default:
+		return newLocalSource(spec)
+	}
+}
+
+// urlSource is a plain JSON index at any URL, signed as <url>.minisig
+type urlSource struct {
+	url string
+}
+
+func (s *urlSource) String() string { return s.url }
+
+func (s *urlSource) Cacheable() bool { return true }
+
+func (s *urlSource) Fetch(validators *indexCacheMeta) (*indexResponse, error) {
+	return fetchIndexPage(s.url, validators, nil)
+}
+
+func (s *urlSource) Signature() ([]byte, error) {
+	return fetchIndexSignature(s.url)
+}
+
+// githubSource reads the GitHub Releases API, following pagination
+type githubSource struct {
+	repo string
+}
+
+func (s *githubSource) String() string { return githubSourcePrefix + ":" + s.repo }
+
+func (s *githubSource) Cacheable() bool { return true }
+
+// GitHub builds the response itself, so there is no file to sign; the API is
+// trusted through TLS and binaries are still checked against asset digests
+func (s *githubSource) Signature() ([]byte, error) {
+	return nil, errUnsignedSource
+}
+
+// githubNextLink matches the rel="next" entry of a Link header
+var githubNextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+func (s *githubSource) Fetch(validators *indexCacheMeta) (*indexResponse, error) {
+	headers := map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+	if token := strings.TrimSpace(os.Getenv(githubTokenEnvVar)); token != "" {
+		debugLog("Authenticating to GitHub with %s", githubTokenEnvVar)
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	// Releases are listed newest first, so an unchanged first page means no
+	// new release; only it is revalidated
+	pageURL := fmt.Sprintf("%s/repos/%s/releases?per_page=100", strings.TrimSuffix(githubAPIURL, "/"), s.repo)
+	first, err := fetchIndexPage(pageURL, validators, headers)
+	if err != nil || first.notModified {
+		return first, err
+	}
+
+	var releases []json.RawMessage
+	page := first
+	for {
+		var pageReleases []json.RawMessage
+		if err := json.Unmarshal(page.body, &pageReleases); err != nil {
+			return nil, fmt.Errorf("failed to decode releases from %s: %w", pageURL, err)
+		}
+		releases = append(releases, pageReleases...)
+
+		match := githubNextLink.FindStringSubmatch(page.link)
+		if match == nil {
+			break
+		}
+		pageURL = match[1]
+		debugLog("Fetching next page of releases: %s", pageURL)
+		if page, err = fetchIndexPage(pageURL, nil, pageHeaders(pageURL, headers)); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(releases)
+	if err != nil {
+		return nil, err
+	}
+	return &indexResponse{body: body, etag: first.etag, lastModified: first.lastModified}, nil
+}
+
+// pageHeaders returns the headers to send to a page URL taken from a Link
+// header. The token only goes to the GitHub API itself.
+func pageHeaders(pageURL string, headers map[string]string) map[string]string {
+	if sameOrigin(pageURL, githubAPIURL) {
+		return headers
+	}
+	debugLog("Not sending %s to %s", githubTokenEnvVar, pageURL)
+	filtered := map[string]string{}
+	for name, value := range headers {
+		if name != "Authorization" {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+// sameOrigin reports whether two URLs have the same scheme and host
+func sameOrigin(a, b string) bool {
+	urlA, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	urlB, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(urlA.Scheme, urlB.Scheme) && strings.EqualFold(urlA.Host, urlB.Host)
+}
+
+// localSource is an index file on disk, signed as <path>.minisig
+type localSource struct {
+	path string
+}
+
+// newLocalSource accepts an index file or a directory containing releases.json
+func newLocalSource(path string) (*localSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("release source %s: %w", path, err)
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, localIndexFileName)
+	}
+	return &localSource{path: path}, nil
+}
+
+func (s *localSource) String() string { return s.path }
+
+// Reading the file is as cheap as reading the cache
+func (s *localSource) Cacheable() bool { return false }
+
+func (s *localSource) Fetch(validators *indexCacheMeta) (*indexResponse, error) {
+	body, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release index: %w", err)
+	}
+	return &indexResponse{body: body}, nil
+}
+
+func (s *localSource) Signature() ([]byte, error) {
+	return os.ReadFile(s.path + indexSignatureSuffix)
+}
+
+type indexResponse struct {
+	body         []byte
+	etag         string
+	lastModified string
+	link         string
+	notModified  bool
+}
+
+// fetchIndexPage downloads url, sending the cached validators (if any) so an
+// unchanged index costs a 304 instead of a full download
+func fetchIndexPage(url string, validators *indexCacheMeta, headers map[string]string) (*indexResponse, error) {
+	// Set a timeout for the HTTP request
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if validators != nil {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch releases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && validators != nil {
+		return &indexResponse{notModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Releases API returned status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases: %w", err)
+	}
+
+	return &indexResponse{
+		body:         body,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		link:         resp.Header.Get("Link"),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReleaseSource(t *testing.T) {
+	indexDir := t.TempDir()
+	indexPath := filepath.Join(indexDir, localIndexFileName)
+	if err := os.WriteFile(indexPath, []byte(`[]`), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"", releasesURL},
+		{"github", "github:" + defaultGitHubRepo},
+		{"github:acme/ddn-mirror", "github:acme/ddn-mirror"},
+		{"https://example.com/index.json", "https://example.com/index.json"},
+		{indexDir, indexPath},
+		{"file:///" + strings.TrimPrefix(filepath.ToSlash(indexPath), "/"), indexPath},
+	}
+	for _, test := range tests {
+		source, err := parseReleaseSource(test.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", test.spec, err)
+		}
+		if source.String() != test.expected {
+			t.Fatalf("Expected %q to select %s, got %s", test.spec, test.expected, source)
+		}
+	}
+
+	for _, spec := range []string{"github:acme", "ftp://example.com/index.json", filepath.Join(indexDir, "missing.json")} {
+		if _, err := parseReleaseSource(spec); err == nil {
+			t.Fatalf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestGitHubSourceFollowsPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/ddn/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			json.NewEncoder(w).Encode([]Release{{TagName: "v2.9.0"}})
+			return
+		}
+		w.Header().Set("ETag", `"page1"`)
+		w.Header().Set("Link", fmt.Sprintf(`<%s/repos/acme/ddn/releases?per_page=100&page=2>; rel="next"`, server.URL))
+		json.NewEncoder(w).Encode([]Release{{TagName: "v3.0.1"}, {TagName: "v3.0.0"}})
+	}))
+	defer server.Close()
+
+	originalGitHubAPIURL := githubAPIURL
+	defer func() {
+		githubAPIURL = originalGitHubAPIURL
+	}()
+	githubAPIURL = server.URL
+	t.Setenv(githubTokenEnvVar, "secret")
+
+	source := &githubSource{repo: "acme/ddn"}
+	resp, err := source.Fetch(nil)
+	if err != nil {
+		t.Fatalf("Failed to fetch releases: %v", err)
+	}
+
+	var releases []Release
+	if err := json.Unmarshal(resp.body, &releases); err != nil {
+		t.Fatalf("Failed to decode merged index: %v", err)
+	}
+	if len(releases) != 3 || releases[2].TagName != "v2.9.0" {
+		t.Fatalf("Expected releases from both pages, got %+v", releases)
+	}
+	if resp.etag != `"page1"` {
+		t.Fatalf("Expected the first page's ETag, got %q", resp.etag)
+	}
+
+	if _, err := source.Signature(); err != errUnsignedSource {
+		t.Fatalf("Expected GitHub to be an unsigned source, got %v", err)
+	}
+}
+
+func TestGitHubSourceKeepsTokenOnAPIHost(t *testing.T) {
+	// The next page is on another host, which must not see the token
+	var leaked bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization") != ""
+		json.NewEncoder(w).Encode([]Release{{TagName: "v2.9.0"}})
+	}))
+	defer other.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/releases?page=2>; rel="next"`, other.URL))
+		json.NewEncoder(w).Encode([]Release{{TagName: "v3.0.1"}})
+	}))
+	defer api.Close()
+
+	originalGitHubAPIURL := githubAPIURL
+	defer func() {
+		githubAPIURL = originalGitHubAPIURL
+	}()
+	githubAPIURL = api.URL
+	t.Setenv(githubTokenEnvVar, "secret")
+
+	source := &githubSource{repo: "acme/ddn"}
+	if _, err := source.Fetch(nil); err != nil {
+		t.Fatalf("Failed to fetch releases: %v", err)
+	}
+	if leaked {
+		t.Fatal("GitHub token was sent to another host")
+	}
+}
+
+func TestLoadReleaseIndexFromLocalSource(t *testing.T) {
+	t.Setenv(indexPublicKeyEnvVar, "")
+	indexDir := t.TempDir()
+	index := `[{"tag_name":"v3.0.1"}]`
+	if err := os.WriteFile(filepath.Join(indexDir, localIndexFileName), []byte(index), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	originalSpec := releaseSourceSpec
+	originalGetCacheDir := getCacheDir
+	defer func() {
+		releaseSourceSpec = originalSpec
+		getCacheDir = originalGetCacheDir
+	}()
+	releaseSourceSpec = indexDir
+	cacheDir := t.TempDir()
+	getCacheDir = func() (string, error) {
+		return cacheDir, nil
+	}
+
+	body, err := loadReleaseIndex()
+	if err != nil {
+		t.Fatalf("Failed to load local index: %v", err)
+	}
+	if string(body) != index {
+		t.Fatalf("Unexpected index: %q", body)
+	}
+
+	// Local indexes are read directly and never cached
+	if cached, err := readCachedIndex(); err != nil || cached != nil {
+		t.Fatalf("Expected no cached index, got %+v (%v)", cached, err)
+	}
+}
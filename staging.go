@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// stagingDirName holds in-progress installs inside the install directory
+	stagingDirName = ".tmp"
+	// stagingMaxAge is how long leftovers of interrupted installs are kept
+	stagingMaxAge = 24 * time.Hour
+)
+
+// createStagingDir creates a fresh staging directory for an install of version
+func createStagingDir(installPath, version string) (string, error) {
+	stagingRoot := filepath.Join(installPath, stagingDirName)
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	cleanupStaging(stagingRoot)
+
+	dir, err := os.MkdirTemp(stagingRoot, version+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return dir, nil
+}
+
+// cleanupStaging removes staging directories left behind by interrupted installs
+func cleanupStaging(stagingRoot string) {
+	entries, err := os.ReadDir(stagingRoot)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < stagingMaxAge {
+			continue
+		}
+		path := filepath.Join(stagingRoot, entry.Name())
+		debugLog("Removing stale staging entry %s", path)
+		os.RemoveAll(path)
+	}
+}
+
+// promoteStagingDir moves a verified staging directory into place. A new
+// version directory is renamed in whole; for an existing one each file is
+// renamed over its old counterpart, so the old binary stays usable until the
+// new one atomically replaces it.
+func promoteStagingDir(stagingDir, versionDir string) error {
+	if _, err := os.Stat(versionDir); os.IsNotExist(err) {
+		return os.Rename(stagingDir, versionDir)
+	}
+
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		src := filepath.Join(stagingDir, entry.Name())
+		dst := filepath.Join(versionDir, entry.Name())
+
+		// Only a directory in the way has to be cleared first
+		if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFailedReinstallKeepsWorkingVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+
+	originalGetInstallDir := getInstallDir
+	originalDownloadBinary := downloadBinary
+	originalLookupChecksum := lookupChecksum
+	originalIndexAsset := indexAsset
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		downloadBinary = originalDownloadBinary
+		lookupChecksum = originalLookupChecksum
+		indexAsset = originalIndexAsset
+	}()
+	getInstallDir = func() (string, error) {
+		return tempDir, nil
+	}
+	lookupChecksum = func(version, downloadURL, osName, archName string) (string, error) {
+		return strings.Repeat("a", 64), nil
+	}
+	indexAsset = func(version, osName, archName string) *Asset {
+		return nil
+	}
+
+	testVersion := "v2.28.0"
+	workingBinary := "#!/bin/sh\necho \"DDN CLI Version: " + testVersion + "\"\n"
+	installMockVersions(t, tempDir, testVersion)
+	binPath := filepath.Join(tempDir, testVersion, binName)
+	if err := os.WriteFile(binPath, []byte(workingBinary), 0755); err != nil {
+		t.Fatalf("Failed to write working binary: %v", err)
+	}
+
+	// The download is interrupted halfway through
+	downloadBinary = func(url, destPath, expectedSHA256 string) error {
+		if err := os.WriteFile(destPath, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+			return err
+		}
+		return fmt.Errorf("connection reset")
+	}
+
+	if err := installVersion(testVersion); err == nil {
+		t.Fatal("Expected the install to fail")
+	}
+
+	content, err := os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("Working binary was removed: %v", err)
+	}
+	if string(content) != workingBinary {
+		t.Fatal("Working binary was overwritten by a failed install")
+	}
+
+	// Nothing is left behind in the staging area
+	entries, err := os.ReadDir(filepath.Join(tempDir, stagingDirName))
+	if err != nil {
+		t.Fatalf("Failed to read staging directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected an empty staging directory, found %d entries", len(entries))
+	}
+
+	// A successful reinstall replaces the binary in place
+	newBinary := "#!/bin/sh\necho \"DDN CLI Version: " + testVersion + " (rebuilt)\"\n"
+	downloadBinary = func(url, destPath, expectedSHA256 string) error {
+		return os.WriteFile(destPath, []byte(newBinary), 0755)
+	}
+	if err := installVersion(testVersion); err != nil {
+		t.Fatalf("Failed to reinstall: %v", err)
+	}
+	content, err = os.ReadFile(binPath)
+	if err != nil {
+		t.Fatalf("Failed to read reinstalled binary: %v", err)
+	}
+	if string(content) != newBinary {
+		t.Fatal("Reinstall did not replace the binary")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFileName records, inside the install directory, what the last switch did
+const stateFileName = "state.json"
+
+// State is what ddnswitch knows about the managed link without running ddn
+type State struct {
+	// Active is the version the last switch linked
+	Active string `json:"active,omitempty"`
+	// LinkPath is where the ddn link was created
+	LinkPath string `json:"link_path,omitempty"`
+	// LinkTarget is what the link pointed to after the switch. Where the
+	// link is a copy, its size and modification time stand in for it. Either
+	// way a link changed by something else can be told apart.
+	LinkTarget  string     `json:"link_target,omitempty"`
+	LinkSize    int64      `json:"link_size,omitempty"`
+	LinkModTime *time.Time `json:"link_mod_time,omitempty"`
+	SwitchedAt  time.Time  `json:"switched_at,omitempty"`
+	// History lists recent switches, oldest first
+	History []HistoryEntry `json:"history,omitempty"`
+}
+
+func statePath() (string, error) {
+	installPath, err := getInstallDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(installPath, stateFileName), nil
+}
+
+// readState loads the state file. A missing or unreadable file is an empty state.
+func readState() State {
+	var state State
+	path, err := statePath()
+	if err != nil {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debugLog("Failed to read %s: %v", path, err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		debugLog("Ignoring invalid %s: %v", path, err)
+		return State{}
+	}
+	return state
+}
+
+// updateState applies update to the state file
+func updateState(update func(state *State)) error {
+	if err := ensureInstallDir(); err != nil {
+		return err
+	}
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+
+	state := readState()
+	update(&state)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// recordSwitch remembers version as the active version, linked at
+// symlinkPath, and adds the switch to the history
+func recordSwitch(version, symlinkPath string) error {
+	return recordActive(version, symlinkPath, true)
+}
+
+// recordActive remembers version as the active version, linked at symlinkPath
+func recordActive(version, symlinkPath string, addToHistory bool) error {
+	info, err := os.Lstat(symlinkPath)
+	if err != nil {
+		return err
+	}
+	target, _ := os.Readlink(symlinkPath)
+
+	debugLog("Recording %s as the active version", version)
+	return updateState(func(state *State) {
+		state.Active = version
+		state.LinkPath = symlinkPath
+		state.LinkTarget = target
+		state.LinkSize = 0
+		state.LinkModTime = nil
+		if target == "" {
+			modTime := info.ModTime()
+			state.LinkSize = info.Size()
+			state.LinkModTime = &modTime
+		}
+		state.SwitchedAt = time.Now().UTC()
+		if addToHistory {
+			appendHistory(state, version, state.SwitchedAt)
+		}
+	})
+}
+
+// activeFromState returns the state recorded by the last switch and whether
+// the link at symlinkPath is still the one that switch left behind
+func activeFromState(symlinkPath string) (State, bool) {
+	state := readState()
+	if state.Active == "" || state.LinkPath != symlinkPath {
+		return state, false
+	}
+
+	info, err := os.Lstat(symlinkPath)
+	if err != nil {
+		return state, false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(symlinkPath)
+		if err != nil || target != state.LinkTarget {
+			debugLog("%s was changed outside ddnswitch (points to %s, recorded %s)", symlinkPath, target, state.LinkTarget)
+			return state, false
+		}
+		if _, err := os.Stat(symlinkPath); err != nil {
+			debugLog("%s no longer works: %v", symlinkPath, err)
+			return state, false
+		}
+		return state, true
+	}
+	if state.LinkTarget != "" || info.Size() != state.LinkSize || state.LinkModTime == nil || !info.ModTime().Equal(*state.LinkModTime) {
+		debugLog("%s was changed outside ddnswitch", symlinkPath)
+		return state, false
+	}
+	// A copy outlives the version it was copied from
+	if binPath, err := versionBinPath(state.Active); err != nil || !isExecutableFile(binPath) {
+		return state, false
+	}
+	return state, true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// writeVersionScripts installs mock binaries that report their own version
+func writeVersionScripts(t *testing.T, dir string, versions ...string) {
+	t.Helper()
+	for _, v := range versions {
+		versionDir := filepath.Join(dir, v)
+		if err := os.MkdirAll(versionDir, 0755); err != nil {
+			t.Fatalf("Failed to create version directory: %v", err)
+		}
+		script := "#!/bin/sh\necho \"DDN CLI Version: " + v + "\"\n"
+		if err := os.WriteFile(filepath.Join(versionDir, binName), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to create mock binary: %v", err)
+		}
+	}
+}
+
+func TestSwitchRecordsActiveVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	originalGetSymlinkPath := getSymlinkPath
+	originalProbeVersion := probeVersion
+	defer func() {
+		getInstallDir = originalGetInstallDir
+		getSymlinkPath = originalGetSymlinkPath
+		probeVersion = originalProbeVersion
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	symlinkPath := filepath.Join(tempDir, "bin", binName)
+	getSymlinkPath = func() (string, error) {
+		return symlinkPath, nil
+	}
+	writeVersionScripts(t, installDir, "v3.0.1", "v3.0.2")
+
+	before := time.Now()
+	if err := switchToVersion("v3.0.1"); err != nil {
+		t.Fatalf("Failed to switch: %v", err)
+	}
+	state := readState()
+	binPath, _ := versionBinPath("v3.0.1")
+	if state.Active != "v3.0.1" || state.LinkPath != symlinkPath || state.LinkTarget != binPath {
+		t.Fatalf("Unexpected state after switching: %+v", state)
+	}
+	if state.SwitchedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("Expected the switch time to be recorded, got %v", state.SwitchedAt)
+	}
+
+	// With the link as the switch left it, nothing is run to find the active version
+	probes := 0
+	probeVersion = func(binPath string) (*semver.Version, error) {
+		probes++
+		return originalProbeVersion(binPath)
+	}
+	if active := activeVersion(); active != "v3.0.1" || probes != 0 {
+		t.Fatalf("Expected v3.0.1 from the state without probing, got %q after %d probes", active, probes)
+	}
+
+	// A link repointed by something else is read from the link instead
+	otherBinary, _ := versionBinPath("v3.0.2")
+	if err := createSymlinkAt(symlinkPath, otherBinary); err != nil {
+		t.Fatalf("Failed to repoint link: %v", err)
+	}
+	if active := activeVersion(); active != "v3.0.2" {
+		t.Fatalf("Expected the externally linked v3.0.2, got %q", active)
+	}
+
+	// A link into the store for a version that isn't installed selects nothing
+	if err := createSymlinkAt(symlinkPath, filepath.Join(installDir, "v9.9.9", binName)); err != nil {
+		t.Fatalf("Failed to repoint link: %v", err)
+	}
+	if active := activeVersion(); active != "" {
+		t.Fatalf("Expected no active version for a dangling link, got %q", active)
+	}
+
+	// Replaced by a copy, the link has to be asked
+	os.Remove(symlinkPath)
+	if err := copyFile(otherBinary, symlinkPath); err != nil {
+		t.Fatalf("Failed to copy binary: %v", err)
+	}
+	if active := activeVersion(); active != "v3.0.2" || probes != 1 {
+		t.Fatalf("Expected v3.0.2 from probing the copy once, got %q after %d probes", active, probes)
+	}
+}
+
+func TestActiveFromStateWithCopiedLink(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetInstallDir := getInstallDir
+	defer func() {
+		getInstallDir = originalGetInstallDir
+	}()
+	installDir := filepath.Join(tempDir, "store")
+	getInstallDir = func() (string, error) {
+		return installDir, nil
+	}
+	installMockVersions(t, installDir, "v3.0.1")
+
+	// Where symlinks aren't available the link is a plain copy
+	binPath, _ := versionBinPath("v3.0.1")
+	symlinkPath := filepath.Join(tempDir, linkFileName())
+	if err := copyFile(binPath, symlinkPath); err != nil {
+		t.Fatalf("Failed to copy binary: %v", err)
+	}
+	if err := recordSwitch("v3.0.1", symlinkPath); err != nil {
+		t.Fatalf("Failed to record switch: %v", err)
+	}
+	if state, ok := activeFromState(symlinkPath); !ok || state.Active != "v3.0.1" {
+		t.Fatalf("Expected the recorded v3.0.1, got %+v (%v)", state, ok)
+	}
+
+	// Another link location isn't covered by the state
+	if _, ok := activeFromState(filepath.Join(tempDir, "elsewhere", linkFileName())); ok {
+		t.Fatal("Expected the state not to apply to another link")
+	}
+
+	// Overwriting the copy is noticed
+	if err := os.WriteFile(symlinkPath, []byte(fmt.Sprintf("other %d", time.Now().UnixNano())), 0755); err != nil {
+		t.Fatalf("Failed to overwrite link: %v", err)
+	}
+	if _, ok := activeFromState(symlinkPath); ok {
+		t.Fatal("Expected an overwritten copy not to match the state")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	// homeEnvVar puts binaries, cache and config under a single directory
+	homeEnvVar = "DDNSWITCH_HOME"
+	appDirName = "ddnswitch"
+)
+
+// xdgDir returns $envVar/ddnswitch, or ~/<fallback>/ddnswitch when the
+// variable is unset. Relative values are ignored, as the spec requires.
+func xdgDir(envVar string, fallback ...string) (string, error) {
+	if base := os.Getenv(envVar); base != "" && filepath.IsAbs(base) {
+		return filepath.Join(base, appDirName), nil
+	}
+	home, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append(append([]string{home}, fallback...), appDirName)...), nil
+}
+
+// ddnswitchHome returns DDNSWITCH_HOME, or an empty string when it isn't set
+func ddnswitchHome() string {
+	if home := os.Getenv(homeEnvVar); home != "" {
+		return expandHome(home)
+	}
+	return ""
+}
+
+// defaultDataDir is where installed versions live: DDNSWITCH_HOME or $XDG_DATA_HOME/ddnswitch
+func defaultDataDir() (string, error) {
+	if home := ddnswitchHome(); home != "" {
+		return home, nil
+	}
+	return xdgDir("XDG_DATA_HOME", ".local", "share")
+}
+
+// defaultCacheDir is where the release index is cached: DDNSWITCH_HOME/cache
+// or $XDG_CACHE_HOME/ddnswitch
+func defaultCacheDir() (string, error) {
+	if home := ddnswitchHome(); home != "" {
+		return filepath.Join(home, cacheDirName), nil
+	}
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// defaultConfigDir holds config.yaml: DDNSWITCH_HOME or $XDG_CONFIG_HOME/ddnswitch
+func defaultConfigDir() (string, error) {
+	if home := ddnswitchHome(); home != "" {
+		return home, nil
+	}
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+var migrateOnce sync.Once
+
+// migrateLegacyStoreOnce moves ~/.ddnswitch to dataDir the first time the
+// install directory is needed. It is a variable so tests can keep it away
+// from a real ~/.ddnswitch.
+var migrateLegacyStoreOnce = func(dataDir string) {
+	migrateOnce.Do(func() {
+		home, err := getHomeDir()
+		if err != nil {
+			return
+		}
+		if err := migrateLegacyStore(filepath.Join(home, legacyInstallDir), dataDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move %s to %s: %v\n", filepath.Join(home, legacyInstallDir), dataDir, err)
+		}
+	})
+}
+
+// migrateLegacyStore moves an old store to dataDir, unless dataDir is already
+// in use, and repoints a ddn link that pointed into it
+func migrateLegacyStore(legacyDir, dataDir string) error {
+	if filepath.Clean(legacyDir) == filepath.Clean(dataDir) {
+		return nil
+	}
+	if info, err := os.Lstat(legacyDir); err != nil || !info.IsDir() {
+		return nil
+	}
+	if storeInUse(dataDir) {
+		debugLog("Both %s and %s exist, leaving the old store alone", legacyDir, dataDir)
+		return nil
+	}
+
+	// Don't move the store from under installs into it, or race another
+	// process migrating it
+	release, err := lockStore(legacyDir)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if storeInUse(dataDir) {
+		// The process we waited for moved it; don't leave just our lock behind
+		os.Remove(filepath.Join(legacyDir, storeLockName))
+		os.Remove(legacyDir)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Moving DDN CLI versions from %s to %s (one-time migration)\n", legacyDir, dataDir)
+
+	// An empty directory would make the rename fail
+	os.Remove(dataDir)
+	if err := os.MkdirAll(filepath.Dir(dataDir), 0755); err != nil {
+		return err
+	}
+	if err := moveDir(legacyDir, dataDir); err != nil {
+		return err
+	}
+
+	// The index cache has its own directory now and is cheap to refetch
+	os.RemoveAll(filepath.Join(dataDir, cacheDirName))
+
+	return repointLegacyLinks(legacyDir, dataDir)
+}
+
+// storeInUse reports whether dir exists and has anything in it
+func storeInUse(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+// moveDir renames src to dst, copying across filesystems when a rename isn't possible
+func moveDir(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	debugLog("Rename failed, copying instead: %v", err)
+
+	// Copy next to the destination first so nobody sees a half-copied store
+	tmpDst := fmt.Sprintf("%s.migrating-%d", dst, os.Getpid())
+	if err := copyTree(src, tmpDst); err != nil {
+		os.RemoveAll(tmpDst)
+		return err
+	}
+	if err := os.Rename(tmpDst, dst); err != nil {
+		os.RemoveAll(tmpDst)
+		return err
+	}
+	// Everything is in place, so a leftover (e.g. a lock still held on Windows) is only worth a warning
+	if err := os.RemoveAll(src); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove %s after copying it: %v\n", src, err)
+	}
+	return nil
+}
+
+// copyTree copies a directory tree, keeping file modes and symlinks. Lock
+// files belong to the processes using src and are left behind.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == storeLockName || rel == versionLocksDir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+	})
+}
+
+// repointLegacyLinks updates ddn links on PATH that point into the old store
+func repointLegacyLinks(legacyDir, dataDir string) error {
+	prefix := filepath.Clean(legacyDir) + string(filepath.Separator)
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if configuredBinDir != "" {
+		dirs = append(dirs, configuredBinDir)
+	}
+	for _, pathDir := range dirs {
+		if pathDir == "" {
+			continue
+		}
+		linkPath := filepath.Join(pathDir, binName)
+		if runtime.GOOS == "windows" {
+			linkPath += ".exe"
+		}
+		target, err := os.Readlink(linkPath)
+		if err != nil || !strings.HasPrefix(target, prefix) {
+			continue
+		}
+
+		newTarget := filepath.Join(dataDir, strings.TrimPrefix(target, prefix))
+		debugLog("Repointing %s from %s to %s", linkPath, target, newTarget)
+		if err := createSymlinkAt(linkPath, newTarget); err != nil {
+			return fmt.Errorf("failed to repoint %s: %w", linkPath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStorageDirectories(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(homeEnvVar, "")
+
+	// XDG variables are honored, with the usual fallbacks when unset
+	xdgData := filepath.Join(home, "data")
+	t.Setenv("XDG_DATA_HOME", xdgData)
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "relative/ignored")
+
+	dirs := []struct {
+		name     string
+		get      func() (string, error)
+		expected string
+	}{
+		{"data", defaultDataDir, filepath.Join(xdgData, "ddnswitch")},
+		{"cache", defaultCacheDir, filepath.Join(home, ".cache", "ddnswitch")},
+		{"config", defaultConfigDir, filepath.Join(home, ".config", "ddnswitch")},
+	}
+	for _, dir := range dirs {
+		got, err := dir.get()
+		if err != nil || got != dir.expected {
+			t.Fatalf("Expected %s directory %s, got %s (%v)", dir.name, dir.expected, got, err)
+		}
+	}
+
+	// DDNSWITCH_HOME puts everything in one place
+	ddnswitchHomeDir := filepath.Join(home, "nfs-free", "ddnswitch")
+	t.Setenv(homeEnvVar, ddnswitchHomeDir)
+	dirs[0].expected = ddnswitchHomeDir
+	dirs[1].expected = filepath.Join(ddnswitchHomeDir, cacheDirName)
+	dirs[2].expected = ddnswitchHomeDir
+	for _, dir := range dirs {
+		got, err := dir.get()
+		if err != nil || got != dir.expected {
+			t.Fatalf("Expected %s directory %s, got %s (%v)", dir.name, dir.expected, got, err)
+		}
+	}
+}
+
+func TestMigrateLegacyStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	home := t.TempDir()
+	legacyDir := filepath.Join(home, legacyInstallDir)
+	installMockVersions(t, legacyDir, "v3.0.1")
+	if err := os.WriteFile(filepath.Join(legacyDir, defaultVersionFile), []byte("v3.0.1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write default version: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(legacyDir, cacheDirName), 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+
+	// The active link points into the old store
+	binDir := filepath.Join(home, "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create bin directory: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(legacyDir, "v3.0.1", binName), filepath.Join(binDir, binName)); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	dataDir := filepath.Join(home, ".local", "share", "ddnswitch")
+	if err := migrateLegacyStore(legacyDir, dataDir); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+
+	if _, err := os.Stat(legacyDir); !os.IsNotExist(err) {
+		t.Fatalf("Expected the old store to be gone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "v3.0.1", binName)); err != nil {
+		t.Fatalf("Installed version was not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, cacheDirName)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the old cache to be dropped, got %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(binDir, binName))
+	if err != nil || target != filepath.Join(dataDir, "v3.0.1", binName) {
+		t.Fatalf("Expected the link to follow the store, got %s (%v)", target, err)
+	}
+
+	// A store that is already in use is never overwritten
+	installMockVersions(t, legacyDir, "v2.9.0")
+	if err := migrateLegacyStore(legacyDir, dataDir); err != nil {
+		t.Fatalf("Second migration failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, "v2.9.0", binName)); err != nil {
+		t.Fatal("Old store was touched although the new one is in use")
+	}
+}
+
+func TestMigrateLegacyStoreWaitsForInstalls(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	originalLockTimeout := lockTimeout
+	lockTimeout = 200 * time.Millisecond
+	defer func() {
+		lockTimeout = originalLockTimeout
+	}()
+
+	home := t.TempDir()
+	legacyDir := filepath.Join(home, legacyInstallDir)
+	installMockVersions(t, legacyDir, "v3.0.1")
+	t.Setenv("PATH", "")
+
+	// An install into the old store holds it shared
+	installLock, _, err := acquireLock(filepath.Join(legacyDir, storeLockName), false, lockTimeout)
+	if err != nil {
+		t.Fatalf("Failed to lock the old store: %v", err)
+	}
+
+	dataDir := filepath.Join(home, ".local", "share", "ddnswitch")
+	if err := migrateLegacyStore(legacyDir, dataDir); errorCode(err) != codeLockTimeout {
+		t.Fatalf("Expected the migration to wait for the install, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, "v3.0.1", binName)); err != nil {
+		t.Fatalf("Old store was moved during an install: %v", err)
+	}
+
+	installLock.Release()
+	if err := migrateLegacyStore(legacyDir, dataDir); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "v3.0.1", binName)); err != nil {
+		t.Fatalf("Installed version was not moved: %v", err)
+	}
+}
+
+func TestMoveDirCopiesAcrossFilesystems(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+
+	src := t.TempDir()
+	installMockVersions(t, src, "v3.0.1")
+	if err := os.Symlink("v3.0.1", filepath.Join(src, "latest")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("Failed to copy tree: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "v3.0.1", binName))
+	if err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Fatalf("Expected an executable copy, got %v (%v)", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "latest")); err != nil || link != "v3.0.1" {
+		t.Fatalf("Expected the symlink to be kept, got %s (%v)", link, err)
+	}
+}